@@ -0,0 +1,340 @@
+/*
+A simple binary which renders a recorded incremental session in the iCNF format as small
+multiples, one panel per query, showing which clauses each query's assumptions satisfy.
+Can be run by `assumptions -f <FILE> > out.dot`, or with `-format html` for a page of
+panels which is easier to scan than a graphviz layout of many clusters.
+
+An iCNF file (`p inccnf`) interleaves clauses with `a <lits> 0` lines, each a query under those
+assumptions over the clauses added so far. A plain CNF is treated as a single query without
+assumptions. There is no solver here, so each query is only unit propagated: starting from the
+assumptions, every clause with a single unassigned literal left and the others false assigns
+it, until nothing changes or a clause is falsified.
+
+Each panel has a node per clause added so far, bordered in bold if it was added since the
+previous query, and filled by its state after propagation: green if an assumption satisfies it,
+yellow if it propagated a literal, light green if it is satisfied by a propagated literal, red
+if it is falsified, which means the query is unsatisfiable, and white if it is still open.
+Variables named by `c var <n> <name>` comments are written by name.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "html"
+  "io"
+  "log"
+  "os"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "iCNF file to render")
+var outFormat = flag.String("format", "dot", "Output format: dot|html")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// names maps variables to the names given by `c var <n> <name>` comments.
+var names = map[int]string{}
+
+func litString(lit int) string {
+  name, ok := names[abs(lit)]
+  if !ok {
+    return strconv.Itoa(lit)
+  }
+  if lit < 0 {
+    return "-" + name
+  }
+  return name
+}
+
+func clauseString(c []int) string {
+  parts := make([]string, len(c))
+  for i, l := range c {
+    parts[i] = litString(l)
+  }
+  return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// query is an `a` line: the assumptions, and the number of clauses added before it.
+type query struct {
+  assumptions []int
+  clauses     int
+}
+
+// maxLine is the longest line the parser accepts.
+const maxLine = 64 * 1024 * 1024
+
+func parse(r io.Reader) ([][]int, []query, error) {
+  var clauses [][]int
+  var queries []query
+  var curr []int
+  // assuming is whether curr holds the literals of an `a` line.
+  assuming := false
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      continue
+    }
+    parts := strings.Fields(t)
+    if len(parts) > 0 && parts[0] == "a" {
+      if len(curr) > 0 || assuming {
+        return nil, nil, fmt.Errorf("line %d: assumptions inside an unterminated line", line)
+      }
+      assuming = true
+      parts = parts[1:]
+    }
+    for _, part := range parts {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item != 0 {
+        curr = append(curr, item)
+        continue
+      }
+      if assuming {
+        queries = append(queries, query{curr, len(clauses)})
+        assuming = false
+      } else {
+        clauses = append(clauses, curr)
+      }
+      curr = nil
+    }
+  }
+  if len(curr) > 0 || assuming {
+    return nil, nil, fmt.Errorf("line %d: last line is not terminated by 0", line)
+  }
+  if len(queries) == 0 {
+    queries = append(queries, query{nil, len(clauses)})
+  }
+  return clauses, queries, scanner.Err()
+}
+
+// clause states after propagating a query.
+const (
+  open = iota
+  assumed
+  propagating
+  implied
+  falsified
+)
+
+var stateNames = []string{"open", "satisfied by an assumption", "propagated a literal", "satisfied by propagation", "falsified"}
+var stateColors = []string{"white", "green", "yellow", "palegreen", "red"}
+
+// propagate unit propagates the assumptions over clauses and returns the state of each clause,
+// and whether the assumptions contradict each other.
+func propagate(clauses [][]int, assumptions []int) ([]int, bool) {
+  states := make([]int, len(clauses))
+  // value[v] is 1 or -1 once v is assigned, and byAssumption[v] whether an assumption did it.
+  value := map[int]int{}
+  byAssumption := map[int]bool{}
+  for _, l := range assumptions {
+    if value[abs(l)] == -sign(l) {
+      return states, true
+    }
+    value[abs(l)] = sign(l)
+    byAssumption[abs(l)] = true
+  }
+propagation:
+  for changed := true; changed; {
+    changed = false
+    for i, c := range clauses {
+      if states[i] == propagating {
+        continue
+      }
+      unassigned, last, satisfied := 0, 0, false
+      for _, l := range c {
+        switch value[abs(l)] {
+        case sign(l):
+          satisfied = true
+        case 0:
+          unassigned++
+          last = l
+        }
+      }
+      switch {
+      case satisfied:
+      case unassigned == 0:
+        states[i] = falsified
+        break propagation
+      case unassigned == 1:
+        value[abs(last)] = sign(last)
+        states[i] = propagating
+        changed = true
+      }
+    }
+  }
+  for i, c := range clauses {
+    if states[i] == propagating || states[i] == falsified {
+      continue
+    }
+    for _, l := range c {
+      if value[abs(l)] == sign(l) {
+        states[i] = implied
+        if byAssumption[abs(l)] {
+          states[i] = assumed
+          break
+        }
+      }
+    }
+  }
+  return states, false
+}
+
+func sign(n int) int {
+  if n > 0 {
+    return 1
+  }
+  return -1
+}
+
+// panel is a query and the state of each clause after propagating it.
+type panel struct {
+  query
+  states []int
+  contradictory bool
+}
+
+// title describes the panel's query and its counts of clauses by state.
+func (p *panel) title(i int) string {
+  lits := make([]string, len(p.assumptions))
+  for j, l := range p.assumptions {
+    lits[j] = litString(l)
+  }
+  counts := make([]int, len(stateNames))
+  for _, s := range p.states {
+    counts[s]++
+  }
+  var parts []string
+  for s, n := range counts {
+    if n > 0 {
+      parts = append(parts, fmt.Sprintf("%d %s", n, stateNames[s]))
+    }
+  }
+  t := fmt.Sprintf("query %d assuming (%s): %d clauses", i+1, strings.Join(lits, ", "), len(p.states))
+  if len(parts) > 0 {
+    t += ", " + strings.Join(parts, ", ")
+  }
+  if p.contradictory {
+    t += ", contradictory assumptions"
+  }
+  return t
+}
+
+func writeDot(w io.Writer, clauses [][]int, panels []panel) error {
+  b := bufio.NewWriter(w)
+  b.WriteString("graph {\n")
+  b.WriteString("  node [ shape = box, style = filled ];\n")
+  escape := strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
+  prev := 0
+  for k, p := range panels {
+    fmt.Fprintf(b, "  subgraph cluster_%d {\n", k)
+    fmt.Fprintf(b, "    label = \"%s\";\n", escape.Replace(p.title(k)))
+    for i, s := range p.states {
+      border := ""
+      if i >= prev {
+        border = ", penwidth = 3"
+      }
+      fmt.Fprintf(b, "    q%d_%d [ label = \"%d\", tooltip = \"%s\", fillcolor = \"%s\"%s ]\n",
+        k, i, i+1, escape.Replace(clauseString(clauses[i])), stateColors[s], border)
+    }
+    b.WriteString("  }\n")
+    prev = p.clauses
+  }
+  b.WriteString("  subgraph cluster_legend {\n")
+  b.WriteString("    label = \"legend\";\n")
+  for s, name := range stateNames {
+    fmt.Fprintf(b, "    legend_%d [ label = \"%s\", fillcolor = \"%s\" ]\n", s, name, stateColors[s])
+  }
+  b.WriteString("    legend_new [ label = \"added since the previous query\", fillcolor = \"white\", penwidth = 3 ]\n")
+  b.WriteString("  }\n")
+  b.WriteString("}\n")
+  return b.Flush()
+}
+
+func writeHTML(w io.Writer, clauses [][]int, panels []panel) error {
+  b := bufio.NewWriter(w)
+  b.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>assumptions</title>\n<style>\n")
+  b.WriteString(".panel { display: flex; flex-wrap: wrap; gap: 2px; margin-bottom: 1em; }\n")
+  b.WriteString(".panel span { width: 12px; height: 12px; border: 1px solid gray; }\n")
+  b.WriteString(".panel span.new { border: 2px solid black; width: 10px; height: 10px; }\n")
+  for s, color := range stateColors {
+    fmt.Fprintf(b, ".s%d { background: %s; }\n", s, color)
+  }
+  b.WriteString("</style>\n</head>\n<body>\n<p>")
+  for s, name := range stateNames {
+    fmt.Fprintf(b, "<span class=\"s%d\">&nbsp;%s&nbsp;</span> ", s, html.EscapeString(name))
+  }
+  b.WriteString("<b>bold</b>: added since the previous query.</p>\n")
+  prev := 0
+  for k, p := range panels {
+    fmt.Fprintf(b, "<h4>%s</h4>\n<div class=\"panel\">", html.EscapeString(p.title(k)))
+    for i, s := range p.states {
+      class := fmt.Sprintf("s%d", s)
+      if i >= prev {
+        class += " new"
+      }
+      fmt.Fprintf(b, "<span class=\"%s\" title=\"%d %s\"></span>", class, i+1, html.EscapeString(clauseString(clauses[i])))
+    }
+    b.WriteString("</div>\n")
+    prev = p.clauses
+  }
+  b.WriteString("</body>\n</html>\n")
+  return b.Flush()
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  if *outFormat != "dot" && *outFormat != "html" {
+    log.Fatalf("Unknown -format %q, expected dot|html", *outFormat)
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  clauses, queries, err := parse(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  panels := make([]panel, len(queries))
+  for i, q := range queries {
+    states, contradictory := propagate(clauses[:q.clauses], q.assumptions)
+    panels[i] = panel{q, states, contradictory}
+  }
+  if *outFormat == "html" {
+    err = writeHTML(os.Stdout, clauses, panels)
+  } else {
+    err = writeDot(os.Stdout, clauses, panels)
+  }
+  if err != nil {
+    log.Fatalln(err)
+  }
+}
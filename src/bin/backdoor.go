@@ -0,0 +1,272 @@
+/*
+A simple binary which finds small strong backdoors of a dimacs file to Horn and 2-SAT, sets of
+variables such that every assignment to them leaves a Horn (or 2-SAT) formula. A small backdoor
+explains why a hard looking instance is easy: a solver only has to branch on the backdoor,
+and the rest is decided by propagation.
+Can be run by `backdoor -f <FILE>`.
+
+For Horn and 2-SAT strong backdoors are exactly deletion backdoors: sets whose literals can be
+removed from every clause to leave the formula in the class. So a backdoor must contain one of
+the variables of every pair of positive literals in a clause (for Horn), or of every three
+literals in a clause (for 2-SAT), and the search branches over these. It tries sizes up to
+`-max` in increasing order, so the first backdoor found is a smallest one, and stops after
+`-budget` search nodes. When no backdoor that small is found a greedy one is reported as an
+upper bound.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "File to search for backdoors")
+var class = flag.String("class", "both", "Class to find a backdoor to: horn|2sat|both")
+var maxSize = flag.Int("max", 10, "Largest backdoor to search for exactly")
+var budget = flag.Int("budget", 1000000, "Number of search nodes to try before giving up on an exact answer")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// varString writes v by its name in names, if it has one.
+func varString(v int, names map[int]string) string {
+  if name, ok := names[v]; ok {
+    return name
+  }
+  return strconv.Itoa(v)
+}
+
+// maxLine is the longest line the parser accepts.
+const maxLine = 64 * 1024 * 1024
+
+// parse returns the clauses of a dimacs file and the variable names given by
+// `c var <n> <name>` comments.
+func parse(r io.Reader) ([][]int, map[int]string, error) {
+  var clauses [][]int
+  names := map[int]string{}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        clauses = append(clauses, curr)
+        curr = nil
+      } else {
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, nil, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return clauses, names, scanner.Err()
+}
+
+// simplify removes duplicate literals and tautologies, which no assignment can leave outside
+// either class.
+func simplify(clauses [][]int) [][]int {
+  var out [][]int
+  for _, c := range clauses {
+    seen := map[int]bool{}
+    var kept []int
+    tautology := false
+    for _, l := range c {
+      if seen[-l] {
+        tautology = true
+        break
+      }
+      if !seen[l] {
+        seen[l] = true
+        kept = append(kept, l)
+      }
+    }
+    if !tautology {
+      out = append(out, kept)
+    }
+  }
+  return out
+}
+
+// obstruction returns the variables of a clause which keep it out of the class once the
+// variables in removed are deleted, one of which any backdoor must contain, or nil if there is
+// no such clause.
+func obstruction(clauses [][]int, removed map[int]bool, horn bool) []int {
+  for _, c := range clauses {
+    var vars []int
+    for _, l := range c {
+      if removed[abs(l)] || (horn && l < 0) {
+        continue
+      }
+      vars = append(vars, abs(l))
+      if (horn && len(vars) == 2) || (!horn && len(vars) == 3) {
+        return vars
+      }
+    }
+  }
+  return nil
+}
+
+// searcher is a bounded depth first search for a backdoor of a given size.
+type searcher struct {
+  clauses [][]int
+  horn bool
+  nodes int
+}
+
+// search extends removed by at most k variables to a backdoor, returning false if there is
+// none or the budget runs out.
+func (s *searcher) search(removed map[int]bool, k int) bool {
+  s.nodes++
+  if s.nodes > *budget {
+    return false
+  }
+  obs := obstruction(s.clauses, removed, s.horn)
+  if obs == nil {
+    return true
+  }
+  if k == 0 {
+    return false
+  }
+  for _, v := range obs {
+    removed[v] = true
+    if s.search(removed, k-1) {
+      return true
+    }
+    delete(removed, v)
+  }
+  return false
+}
+
+// greedy builds a backdoor by repeatedly removing the variable occurring in the most
+// obstructions.
+func greedy(clauses [][]int, horn bool) map[int]bool {
+  removed := map[int]bool{}
+  for {
+    counts := map[int]int{}
+    for _, c := range clauses {
+      var vars []int
+      for _, l := range c {
+        if !removed[abs(l)] && !(horn && l < 0) {
+          vars = append(vars, abs(l))
+        }
+      }
+      if (horn && len(vars) >= 2) || (!horn && len(vars) >= 3) {
+        for _, v := range vars {
+          counts[v]++
+        }
+      }
+    }
+    if len(counts) == 0 {
+      return removed
+    }
+    best := 0
+    for v, n := range counts {
+      if best == 0 || n > counts[best] || (n == counts[best] && v < best) {
+        best = v
+      }
+    }
+    removed[best] = true
+  }
+}
+
+// setString lists the variables of set after a colon, or returns nothing for an empty set.
+func setString(set map[int]bool, names map[int]string) string {
+  vars := make([]int, 0, len(set))
+  for v := range set {
+    vars = append(vars, v)
+  }
+  sort.Ints(vars)
+  parts := make([]string, len(vars))
+  for i, v := range vars {
+    parts[i] = varString(v, names)
+  }
+  if len(parts) == 0 {
+    return ""
+  }
+  return ": " + strings.Join(parts, " ")
+}
+
+// report finds a smallest backdoor to Horn or 2-SAT and writes it to w.
+func report(w io.Writer, clauses [][]int, names map[int]string, horn bool) {
+  name := "2-SAT"
+  if horn {
+    name = "Horn"
+  }
+  s := &searcher{clauses: clauses, horn: horn}
+  for k := 0; k <= *maxSize; k++ {
+    removed := map[int]bool{}
+    if s.search(removed, k) {
+      fmt.Fprintf(w, "%s: smallest strong backdoor has size %d%s\n", name, k, setString(removed, names))
+      return
+    }
+    if s.nodes > *budget {
+      g := greedy(clauses, horn)
+      fmt.Fprintf(w, "%s: budget exhausted, no backdoor of size below %d, greedy found one of size %d%s\n", name, k, len(g), setString(g, names))
+      return
+    }
+  }
+  g := greedy(clauses, horn)
+  fmt.Fprintf(w, "%s: no backdoor of size at most %d, greedy found one of size %d%s\n", name, *maxSize, len(g), setString(g, names))
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  if *class != "horn" && *class != "2sat" && *class != "both" {
+    log.Fatalf("Unknown -class %q, expected horn|2sat|both", *class)
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  clauses, names, err := parse(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  clauses = simplify(clauses)
+  out := bufio.NewWriter(os.Stdout)
+  defer out.Flush()
+  if *class != "2sat" {
+    report(out, clauses, names, true)
+  }
+  if *class != "horn" {
+    report(out, clauses, names, false)
+  }
+}
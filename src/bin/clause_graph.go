@@ -2,21 +2,223 @@
 A simple binary to create a graphviz graph which relates clauses by the literals
 they contain.
 Can be run on a dimacs file by running `clause_graph -f <FILE>`.
+It is built with the file mapping inputs for its platform, by
+`go build clause_graph.go clause_graph_mmap_unix.go`, or with `clause_graph_mmap_other.go`
+instead on systems without mmap, which read every input.
+Several files or directories can be given by repeating `-f`, in which case `-o <DIR>` writes one
+graph per input, named by the `-name` template, failing before writing anything if two inputs
+get the same name. For a single input, `-o out.dot` writes the graph to that file.
+
+Most tools can't open DOT files of hundreds of megabytes, so a clause graph written to a file
+may be split into shards of about `-shard` nodes and edges (a million by default). Each shard is
+a complete graph of a range of clauses, with their edges to later clauses, which graphviz draws
+as bare numbered nodes, and the shards of `out.dot` are written to `out-001.dot`, `out-002.dot`
+and so on, listed with their clause ranges and sizes in `out-index.tsv`. Graphs which can't be
+that large, by a bound on their edges from the occurrence counts, are written whole as before,
+as are clustered graphs and graphs written to stdout.
+`-render out.svg` (or `out.png`) lays the graph out with a force directed layout and draws it
+directly, for machines without graphviz. This is quadratic in the number of clauses, so it is
+meant for small and medium graphs.
+
+`-classify` marks tautological (dotted), subsumed (dashed), blocked (bold) and unit implied
+(double border) clauses, and `-core <FILE>` writes the remaining irredundant clauses. For GCNF
+the core keeps every group's meaning, for MUS extraction over groups: only hard clauses (group
+0) and clauses of the same group can make a clause subsumed or unit implied, and a clause is
+only blocked if it is blocked by every clause of the input.
+
+`-lines` tracks each clause back to the input line it starts on, so what a graph shows can be
+found in the generated file: clauses are labeled with their line, the redundant clauses of
+`-classify` are logged as `<file>:<line>:` like compiler diagnostics, and the clauses written by
+`-core` and `-communities` are each preceded by a `c line <n>` comment.
+
+By default edges between clauses which share a literal with the same polarity are red, and
+edges between clauses which share a variable with opposite polarity are blue, with at most one
+edge of each kind between two clauses. This can be changed with `-same-color`, `-diff-color`
+and `-color-by`, and `-styles` draws the two kinds as solid and dashed lines for grayscale
+printing.
+
+Each edge stands for the first variable its clauses share with its polarity relation.
+`-edge-labels label` labels it with every such variable and whether their polarities agree,
+and `-edge-labels tooltip` puts that in a tooltip instead, which graphviz's SVG output and the
+SVG of `-render` show on hover, so it is easy to trace why two clauses are related.
+
+`-mode factor` draws the bipartite factor graph instead, with clauses as boxes and variables as
+circles, joined by solid edges for positive occurrences and dashed edges for negative ones.
+
+`-mode var` draws the graph joining variables which share a clause. With `-heatmap` each
+variable is filled on a blue to red gradient by its number of occurrences, on a log scale, and
+sized by its degree, with the color scale in the legend of `-legend`, so the hotspots of an
+encoding stand out.
+
+`-mode defs` draws the DAG of the variables defined by gates found in the clauses instead, with
+an edge from each input of a gate to the variable it defines. And and or gates, equivalences and
+two input xors are recognized from their Tseitin clauses, and the number of each is logged.
+This is usually the structure the author of an encoder wants to inspect.
+
+`-format edgelist` writes the edges as a tab separated table with a header row, for loading into
+NetworkX or igraph without a graphviz parser. In the clause graph each pair of clauses has a
+row for each polarity they share a variable with, weighted by the number of such variables. In
+the factor graph the polarity is pos or neg and the weight is 1.
+
+`-communities <DIR>` detects communities of the clause graph by label propagation, and writes
+the clauses of each to `<name>.community<k>.cnf` in DIR, keeping the original variable numbers,
+along with `<name>.interface.txt`, which lists each community's interface variables, those
+which also occur in another community. This supports decomposition based solving experiments.
+
+`-separators <K>` looks for K variables whose removal most disconnects the clause graph, so
+that the clauses only join through the other variables. They are picked greedily among the
+variables in the most clauses, each time removing the one which leaves the smallest largest
+component, and each pick is logged with the components it leaves. `-separator-dir <DIR>` then
+writes the clauses of each component, largest first, to `<name>.part<k>.cnf` in DIR, and those
+over the separators alone to `<name>.separators.cnf`, along with a `<name>.separators.txt`
+report. The parts are written as they are, keeping their separator literals, unless
+`-separator-assign` sets some separators, given as literals such as `"3 -7"`. Each part and the
+clauses over the separators alone are then written with the clauses the assignment satisfies
+removed and the separator literals it falsifies dropped, so once every separator is set the
+parts are formulas independent of each other.
+
+`-centrality pagerank` (or `eigenvector`) adds a `centrality` attribute to each node, computed
+on the graph being drawn, and `-top <N>` logs the N variables most central in the graph joining
+variables which share a clause, which are often good branching variables.
+
+Unit clauses, clauses containing a pure literal and duplicate clauses dominate the clutter in
+the output of many encoders, and can be dropped before the graph is built with `-drop-units`,
+`-drop-pure` and `-drop-duplicates`. Pure literals are those of the input, and dropping is not
+repeated on the result.
+
+A variable in thousands of clauses joins every pair of them, so its edges grow quadratically and
+bury the rest of the graph. A variable in more than `-hub` clauses (1000 by default) is instead
+drawn as a diamond hub node labeled with its number of occurrences, joined to each clause
+containing it like a variable of the factor graph, and clauses are only joined directly through
+the other variables they share. `-hub 0` draws every edge, as does `-render`, whose layout only
+places clauses.
+
+`-filter <EXPR>` keeps only the clauses for which an expression holds, after the drops above,
+so big instances can be sliced without a preprocessing script. Expressions combine comparisons
+of `len`, `pos` and `neg` (the numbers of literals, positive and negative literals), `index`
+(the clause number, from 0) and `group` (the GCNF group) with integers, and
+`contains(<lit>)`, true if the clause contains the literal, and `var(<var>)`, true if it
+contains the variable in either polarity, by `&&`, `||`, `!` and parentheses. Literals are
+numbers or names, as in `contains(-x)`, and a name given to several variables is rejected as
+ambiguous. Clauses are renumbered after filtering.
+
+Variables named by `c var <n> <name>` comments are labeled by name, unless `-names=false`.
+
+The output only depends on the input, but clause numbers and edge order follow the order of the
+clauses and literals in the file. `-canonical` sorts the literals of each clause, the clauses,
+and the edges of every clause by the clause they join, before anything else is done, so inputs
+differing only in those orders give the same output, for golden file tests and diffs.
+
+`-features` writes size, balance and graph features of each input as JSON instead of the graph,
+for building algorithm selection portfolios. There is no solver here, so unlike SATzilla there
+are no probing features.
+
+`-compare <FILE>` instead compares the clause graphs of the input and FILE, for finding near
+duplicate benchmarks. It writes the Kolmogorov-Smirnov distance between their clause and
+variable degree distributions, and their spectral signatures: the largest `-spectrum`
+eigenvalues of the normalized adjacency matrix, which do not depend on the graph's size, and
+the euclidean distance between them.
+
+With `-cluster-comments`, clauses are placed in clusters named by the `c` comment block which
+precedes them, which makes the output of encoders that annotate their constraints legible.
+
+Group oriented CNF (`p gcnf`, with each clause prefixed by `{<group>}`) is also accepted. Its
+clauses are clustered by group, with group 0 holding the hard clauses, unless
+`-cluster-comments` is given, and `-core` then writes GCNF keeping each clause's group.
+
+A line starting with `%` ends the formula, as in the SATLIB benchmarks, whose trailing `0` would
+otherwise be read as an empty clause. An empty clause makes the formula unsatisfiable, and is
+drawn as a `()` node without edges, while a formula without clauses gives an empty graph.
 */
 package main
 
 import (
+  "encoding/json"
   "fmt"
+  "html"
+  "image"
+  "image/color"
+  "image/draw"
+  "image/png"
+  "io"
+  "math"
+  "math/bits"
+  "math/rand"
   "os"
+  "path/filepath"
   "bufio"
+  "bytes"
   "flag"
   "log"
   "strings"
   "strconv"
   "sort"
+  "sync"
+  "sync/atomic"
+  "time"
+  "runtime"
 )
 
-var filePath = flag.String("f", "", "File to read graph from")
+// fileList is a flag which may be passed multiple times.
+type fileList []string
+
+func (l *fileList) String() string { return strings.Join(*l, ",") }
+
+func (l *fileList) Set(v string) error {
+  *l = append(*l, v)
+  return nil
+}
+
+var filePaths fileList
+
+var outDir = flag.String("o", "", "Directory to write one graph per input to, or with a single input a .dot file, instead of stdout")
+var shardSize = flag.Int("shard", 1000000, "Split clause graphs written to a file into shards of about this many nodes and edges, 0 never splits")
+var nameTemplate = flag.String("name", "{name}.dot", "Output file name in -o, {name} is the input without extension and {base} the input file name")
+var sameColor = flag.String("same-color", "red", "Edge color for clauses sharing a literal with the same polarity")
+var diffColor = flag.String("diff-color", "blue", "Edge color for clauses sharing a variable with different polarity")
+var colorBy = flag.String("color-by", "polarity", "How to color edges: var|polarity|none")
+var styles = flag.Bool("styles", false, "Draw same polarity edges solid and different polarity edges dashed")
+var clusterComments = flag.Bool("cluster-comments", false, "Group clauses into clusters labeled by the comment block preceding them")
+var render = flag.String("render", "", "Also lay out the graph and draw it to this .svg or .png file, without graphviz")
+var classifyClauses = flag.Bool("classify", false, "Classify clauses as tautological, subsumed, blocked or unit implied, and mark them by node border")
+var corePath = flag.String("core", "", "With -classify, write the irredundant clauses to this file")
+var parseThreads = flag.Int("parse-threads", runtime.NumCPU(), "Number of goroutines used to parse large inputs, 1 always parses sequentially")
+var parseStats = flag.Bool("parse-stats", false, "Log how the parser allocated storage for each input")
+var graphThreads = flag.Int("graph-threads", runtime.NumCPU(), "Number of goroutines used to build occurrence lists and edges of large inputs, 1 always builds sequentially")
+
+var showProgress = flag.Bool("progress", false, "Report parsing and edge generation progress on stderr for large inputs")
+var useNames = flag.Bool("names", true, "Label literals with the variable names given by \"c var <n> <name>\" comments")
+var legend = flag.Bool("legend", false, "Emit a legend subgraph describing edge colors and styles")
+var mode = flag.String("mode", "clause", "Graph to draw: clause, joining clauses, factor, the bipartite clause-variable graph, var, joining variables, or defs, the DAG of variable definitions")
+var heatmap = flag.Bool("heatmap", false, "With -mode var, color variables by occurrence count and size them by degree")
+var comparePath = flag.String("compare", "", "Compare the clause graph of the input with this file's, writing similarity metrics as JSON")
+var spectrumSize = flag.Int("spectrum", 8, "Number of eigenvalues in the spectral signature of -compare")
+var centralityKind = flag.String("centrality", "none", "Annotate nodes with a centrality attribute: none|pagerank|eigenvector")
+var topVars = flag.Int("top", 0, "Log this many of the most central variables of the variable graph")
+var outFormat = flag.String("format", "dot", "Output format: dot, or edgelist for a tab separated src, dst, polarity, weight table")
+var numSeparators = flag.Int("separators", 0, "Log this many variables whose removal most disconnects the clause graph, picked greedily")
+var separatorDir = flag.String("separator-dir", "", "With -separators, write the clauses of each component left after removing them to this directory")
+var separatorAssign = flag.String("separator-assign", "", "With -separator-dir, simplify the written parts by this assignment of separators, as literals such as \"3 -7\"")
+var communityDir = flag.String("communities", "", "Detect communities of the clause graph and write each one's clauses and an interface report to this directory")
+var dropUnits = flag.Bool("drop-units", false, "Drop unit clauses before building the graph")
+var dropPure = flag.Bool("drop-pure", false, "Drop clauses containing a pure literal before building the graph")
+var dropDuplicates = flag.Bool("drop-duplicates", false, "Drop clauses with the same literals as an earlier clause before building the graph")
+var canonical = flag.Bool("canonical", false, "Sort clauses, literals and edges so the output does not depend on their order in the input")
+var features = flag.Bool("features", false, "Write instance features as JSON instead of the graph")
+var filterExpr = flag.String("filter", "", "Only keep the clauses for which this expression holds, e.g. \"len>=3 && contains(42)\"")
+var edgeLabels = flag.String("edge-labels", "none", "Annotate clause graph edges with their shared variables and polarity: none|label|tooltip")
+var showLines = flag.Bool("lines", false, "Label clauses with the input line they start on, log each redundant clause found by -classify by line, and comment the clauses of -core and -communities with their lines")
+var hubThreshold = flag.Int("hub", 1000, "Draw variables in more than this many clauses as a hub node instead of joining their clauses pairwise, 0 never does")
+
+// filter is the parsed -filter expression, or nil.
+var filter *filterNode
+
+// palette used for -color-by var, indexed by variable. These names are valid in both graphviz
+// and SVG.
+var palette = []string{
+  "red", "blue", "darkgreen", "orange", "purple", "brown", "magenta", "darkcyan",
+  "goldenrod", "navy", "olivedrab", "deeppink", "sienna", "steelblue", "darkviolet", "dimgray",
+}
 
 func abs(n int) int {
   if n > 0 {
@@ -34,80 +236,3713 @@ func sign(n int) int {
   return -1
 }
 
-func clauseString(c []int) string {
+func clauseString(c []int32, names map[int32]string) string {
   var s = "("
   for i, lit := range c {
-    if i == 0 {
-      s += strconv.Itoa(lit)
-      continue
+    if i > 0 {
+      s += ", "
     }
-    s += fmt.Sprintf(", %d", lit)
+    s += litString(lit, names)
   }
   s += ")"
   return s
 }
 
-func main() {
-  flag.Parse()
-  if *filePath == "" {
-    log.Fatalln("Must pass file")
+// litString returns the name of lit's variable from names, negated with a '-', or its number
+// if it has no name.
+func litString(lit int32, names map[int32]string) string {
+  name, ok := names[varOf(lit)]
+  if !ok {
+    return strconv.Itoa(int(lit))
   }
-  file, err := os.Open(*filePath)
-  if err != nil {
-    log.Fatalln(err)
+  if lit < 0 {
+    return "-" + name
   }
-  var clauses [][]int
-  var currClause []int
-  scanner := bufio.NewScanner(file)
-  for scanner.Scan() {
-    t := scanner.Text()
-    if strings.HasPrefix(t, "c") || strings.HasPrefix(t, "p") {
+  return name
+}
+
+// varOf returns the variable of literal l.
+func varOf(l int32) int32 {
+  if l < 0 {
+    return -l
+  }
+  return l
+}
+
+func sortLits(c []int32) {
+  sort.Slice(c, func(i, j int) bool { return c[i] < c[j] })
+}
+
+// edge is an edge between two clauses which both contain variable v.
+type edge struct {
+  a, b int
+  v int
+  same bool
+}
+
+// edgeStyle returns the color (empty for none) and whether an edge should be dashed.
+func edgeStyle(v int, same bool) (string, bool) {
+  color := ""
+  switch *colorBy {
+  case "polarity":
+    if same {
+      color = *sameColor
+    } else {
+      color = *diffColor
+    }
+  case "var":
+    color = palette[v%len(palette)]
+  }
+  return color, *styles && !same
+}
+
+func edgeAttrs(v int, same bool) string {
+  var attrs []string
+  color, dashed := edgeStyle(v, same)
+  if color != "" {
+    attrs = append(attrs, fmt.Sprintf("color=\"%s\"", color))
+  }
+  if *styles {
+    if dashed {
+      attrs = append(attrs, "style=\"dashed\"")
+    } else {
+      attrs = append(attrs, "style=\"solid\"")
+    }
+  }
+  if len(attrs) == 0 {
+    return ""
+  }
+  return " [ " + strings.Join(attrs, ", ") + " ]"
+}
+
+// sharedLits returns the literals of a whose variable occurs in b, with the same polarity if
+// same and with the opposite one otherwise.
+func sharedLits(a, b []int32, same bool) []int32 {
+  var shared []int32
+  for _, la := range a {
+    for _, lb := range b {
+      if varOf(la) == varOf(lb) && (la == lb) == same {
+        shared = append(shared, la)
+        break
+      }
+    }
+  }
+  return shared
+}
+
+// edgeDescription describes why e joins its clauses: every variable they share with the edge's
+// polarity relation, and whether the polarities agree.
+func edgeDescription(f *formula, e edge) string {
+  names := f.labelNames()
+  shared := sharedLits(f.clauses[e.a], f.clauses[e.b], e.same)
+  parts := make([]string, len(shared))
+  for i, l := range shared {
+    parts[i] = litString(l, names)
+  }
+  if e.same {
+    return strings.Join(parts, ", ") + " (same polarity)"
+  }
+  return strings.Join(parts, ", ") + " (opposite polarity)"
+}
+
+// withEdgeLabel adds e's description to the edge attributes attrs, as a label or tooltip per
+// -edge-labels.
+func withEdgeLabel(attrs string, f *formula, e edge) string {
+  if *edgeLabels == "none" {
+    return attrs
+  }
+  desc := strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(edgeDescription(f, e))
+  extra := fmt.Sprintf("%s=\"%s\"", *edgeLabels, desc)
+  if attrs == "" {
+    return " [ " + extra + " ]"
+  }
+  return strings.TrimSuffix(attrs, " ]") + ", " + extra + " ]"
+}
+
+func writeLegend(s *bufio.Writer, hubs bool) {
+  s.WriteString("  subgraph cluster_legend {\n")
+  s.WriteString("    label = \"legend\";\n")
+  s.WriteString("    node [ shape = plaintext ];\n")
+  switch {
+  case *colorBy == "var":
+    s.WriteString("    legend_color [ label = \"edge color = shared variable\" ]\n")
+  case *colorBy == "polarity" || *styles:
+    s.WriteString("    legend_same_a [ label = \"same polarity\" ]\n")
+    s.WriteString("    legend_same_b [ label = \"\" ]\n")
+    fmt.Fprintf(s, "    legend_same_a -- legend_same_b%s\n", edgeAttrs(0, true))
+    s.WriteString("    legend_diff_a [ label = \"different polarity\" ]\n")
+    s.WriteString("    legend_diff_b [ label = \"\" ]\n")
+    fmt.Fprintf(s, "    legend_diff_a -- legend_diff_b%s\n", edgeAttrs(0, false))
+  default:
+    s.WriteString("    legend_none [ label = \"edges join clauses sharing a variable\" ]\n")
+  }
+  if hubs {
+    fmt.Fprintf(s, "    legend_hub [ label = \"variable in more than %d clauses,\\ndashed to negative occurrences\", shape = diamond ]\n", *hubThreshold)
+  }
+  if *classifyClauses {
+    for c := tautological; c <= unitImplied; c++ {
+      fmt.Fprintf(s, "    legend_class_%d [ label = \"%s\", shape = box%s ]\n", c, classNames[c], classAttrs[c])
+    }
+  }
+  s.WriteString("  }\n")
+}
+
+// formula is a parsed dimacs file.
+type formula struct {
+  // vars and numClauses are the counts declared in the header, or -1 without a header.
+  vars, numClauses int
+  // clauses are stored as int32 to halve their size; the parser rejects wider literals.
+  clauses [][]int32
+  // groups[i] is the index in groupNames of the comment block clause i appeared under, or -1.
+  groups []int
+  groupNames []string
+  // lines[i] is the input line clause i starts on, counting from 1.
+  lines []int
+  // classes[i] is the redundancy class of clause i, set by -classify.
+  classes []int
+  // centrality[i] is the centrality of clause i, and varCentrality[v] that of variable v in the
+  // factor graph, set by -centrality.
+  centrality []float64
+  varCentrality []float64
+  // names maps variables to the names given by `c var <n> <name>` comments.
+  names map[int32]string
+  // gcnfGroups[i] is the GCNF group of clause i, and nil for plain CNF. numGCNFGroups is the
+  // group count declared in the header.
+  gcnfGroups []int
+  numGCNFGroups int
+  // alloc records how the parser allocated the clauses.
+  alloc allocStats
+  // mismatch is set if the clause count disagrees with the header. This is common in hand
+  // written files, so it is a warning rather than a parse error.
+  mismatch *ErrHeaderMismatch
+}
+
+// labelNames returns the names to label literals with, or nil if -names=false.
+func (f *formula) labelNames() map[int32]string {
+  if !*useNames {
+    return nil
+  }
+  return f.names
+}
+
+// ErrSyntax is returned for malformed input, at a 1-based line and column.
+type ErrSyntax struct {
+  Line, Col int
+  Msg string
+}
+
+func (e *ErrSyntax) Error() string {
+  return fmt.Sprintf("line %d, col %d: %s", e.Line, e.Col, e.Msg)
+}
+
+// ErrHeaderMismatch is the warning a formula carries when the number of clauses differs from
+// the header.
+type ErrHeaderMismatch struct {
+  Declared, Found int
+}
+
+func (e *ErrHeaderMismatch) Error() string {
+  return fmt.Sprintf("header declares %d clauses but found %d", e.Declared, e.Found)
+}
+
+// ErrVarOutOfRange is returned for a literal whose variable exceeds the header's count.
+type ErrVarOutOfRange struct {
+  Line, Col int
+  Var, Max int
+}
+
+func (e *ErrVarOutOfRange) Error() string {
+  return fmt.Sprintf("line %d, col %d: variable %d exceeds declared %d", e.Line, e.Col, e.Var, e.Max)
+}
+
+// field is a whitespace separated token and its 1-based column.
+type field struct {
+  text string
+  col int
+}
+
+func splitFields(t string) []field {
+  var out []field
+  start := -1
+  for i := 0; i <= len(t); i++ {
+    if i == len(t) || t[i] == ' ' || t[i] == '\t' || t[i] == '\r' {
+      if start >= 0 {
+        out = append(out, field{t[start:i], start + 1})
+        start = -1
+      }
+    } else if start < 0 {
+      start = i
+    }
+  }
+  return out
+}
+
+// Kinds of token produced by tokenizeLine.
+const (
+  tokComment = iota
+  tokHeader
+  tokLiteral
+  tokClauseEnd
+  tokGroup
+  tokEnd
+  tokInvalid
+)
+
+// token is a lexical item of a dimacs file. For a header lit and n are the declared variable
+// and clause counts, and groups the group count of a GCNF header or -1. For a literal or a
+// GCNF group lit is its value, and text holds comment text or the message of an invalid token.
+type token struct {
+  kind int
+  line, col int
+  lit, n int
+  groups int
+  text string
+}
+
+// tokenizeLine appends the tokens of line t, numbered line, to out.
+func tokenizeLine(t string, line int, out []token) []token {
+  // the SATLIB benchmarks end with a `%` line and a stray `0`, which aren't part of the formula.
+  if strings.HasPrefix(t, "%") {
+    return append(out, token{kind: tokEnd, line: line, col: 1})
+  }
+  if strings.HasPrefix(t, "c") {
+    return append(out, token{kind: tokComment, line: line, col: 1, text: strings.TrimSpace(t[1:])})
+  }
+  if strings.HasPrefix(t, "p") {
+    parts := splitFields(t)
+    gcnf := len(parts) == 5 && parts[1].text == "gcnf"
+    if !gcnf && (len(parts) != 4 || parts[1].text != "cnf") {
+      return append(out, token{kind: tokInvalid, line: line, col: 1, text: "expected header \"p cnf <vars> <clauses>\" or \"p gcnf <vars> <clauses> <groups>\""})
+    }
+    vars, err := strconv.Atoi(parts[2].text)
+    if err != nil || vars < 0 {
+      return append(out, token{kind: tokInvalid, line: line, col: parts[2].col, text: "invalid variable count " + parts[2].text})
+    }
+    if vars > math.MaxInt32 {
+      return append(out, token{kind: tokInvalid, line: line, col: parts[2].col, text: "variable count " + parts[2].text + " does not fit in 32 bits"})
+    }
+    n, err := strconv.Atoi(parts[3].text)
+    if err != nil || n < 0 {
+      return append(out, token{kind: tokInvalid, line: line, col: parts[3].col, text: "invalid clause count " + parts[3].text})
+    }
+    groups := -1
+    if gcnf {
+      groups, err = strconv.Atoi(parts[4].text)
+      if err != nil || groups < 0 {
+        return append(out, token{kind: tokInvalid, line: line, col: parts[4].col, text: "invalid group count " + parts[4].text})
+      }
+    }
+    return append(out, token{kind: tokHeader, line: line, col: 1, lit: vars, n: n, groups: groups})
+  }
+  for _, part := range splitFields(t) {
+    if strings.HasPrefix(part.text, "{") {
+      g, err := strconv.Atoi(strings.TrimSuffix(part.text[1:], "}"))
+      if err != nil || g < 0 || !strings.HasSuffix(part.text, "}") {
+        return append(out, token{kind: tokInvalid, line: line, col: part.col, text: "invalid group " + part.text})
+      }
+      out = append(out, token{kind: tokGroup, line: line, col: part.col, lit: g})
       continue
     }
-    for _, part := range strings.Fields(t) {
-      item, err := strconv.Atoi(part)
-      if err != nil {
-        log.Fatalln(err)
+    item, err := strconv.Atoi(part.text)
+    switch {
+    case err != nil:
+      return append(out, token{kind: tokInvalid, line: line, col: part.col, text: "invalid literal " + part.text})
+    case item > math.MaxInt32 || item < -math.MaxInt32:
+      return append(out, token{kind: tokInvalid, line: line, col: part.col, text: "literal " + part.text + " does not fit in 32 bits"})
+    case item == 0:
+      out = append(out, token{kind: tokClauseEnd, line: line, col: part.col})
+    default:
+      out = append(out, token{kind: tokLiteral, line: line, col: part.col, lit: item})
+    }
+  }
+  return out
+}
+
+// builder assembles a formula from tokens. Consecutive comment lines form a block, and each
+// clause is attributed to the most recent block before it, since encoders often name the
+// constraint they are about to emit. The header ends any block which precedes it.
+type builder struct {
+  f *formula
+  currClause []int32
+  currGroup int
+  // currGCNFGroup is the GCNF group of the clause being read, or -1 before its `{<group>}`.
+  currGCNFGroup int
+  // lastComment is the line of the previous token if it was a comment, else 0.
+  lastComment int
+  // arena is the block the literals of finished clauses are copied into, and reserved whether
+  // clause storage was already sized by reserve.
+  arena []int32
+  reserved bool
+  // ended is whether a `%` line was read, after which tokens are ignored.
+  ended bool
+  // currLine is the line the clause being read started on, or 0 before its first token.
+  currLine int
+}
+
+// allocStats records how the parser allocated a formula's storage, for -parse-stats.
+type allocStats struct {
+  // ReservedClauses is the capacity the clause list was created with, and ClauseGrowths the
+  // number of times it had to be reallocated after that.
+  ReservedClauses int
+  ClauseGrowths int
+  // Literals is the number of literals stored, in LiteralBlocks blocks with a total capacity of
+  // LiteralCapacity.
+  Literals int
+  LiteralBlocks int
+  LiteralCapacity int
+  // Exact is whether the sizes came from a scan of the whole input rather than the header.
+  Exact bool
+}
+
+// arenaBlock is the largest number of literals in a block of the arena when their total isn't
+// known.
+const arenaBlock = 64 * 1024
+
+// maxHeaderReserve is the most clauses reserved on the word of a header alone, so a corrupt
+// header can't allocate unbounded memory.
+const maxHeaderReserve = 1 << 24
+
+// reserve sizes the clause storage for the given number of clauses and literals, where
+// literals may be 0 if unknown.
+func (b *builder) reserve(clauses, literals int, exact bool) {
+  f := b.f
+  f.clauses = make([][]int32, 0, clauses)
+  f.groups = make([]int, 0, clauses)
+  f.lines = make([]int, 0, clauses)
+  f.alloc.ReservedClauses = clauses
+  f.alloc.Exact = exact
+  if literals > 0 {
+    b.arena = make([]int32, 0, literals)
+    f.alloc.LiteralBlocks++
+    f.alloc.LiteralCapacity += literals
+  }
+  b.reserved = true
+}
+
+// parseVarName parses the text of a `c var <n> <name>` comment. Malformed ones are treated as
+// ordinary comments.
+func parseVarName(text string) (int32, string, bool) {
+  parts := strings.Fields(text)
+  if len(parts) != 3 || parts[0] != "var" {
+    return 0, "", false
+  }
+  v, err := strconv.ParseInt(parts[1], 10, 32)
+  if err != nil || v <= 0 {
+    return 0, "", false
+  }
+  return int32(v), parts[2], true
+}
+
+func newBuilder() *builder {
+  return &builder{f: &formula{vars: -1, numClauses: -1}, currGroup: -1, currGCNFGroup: -1}
+}
+
+func (b *builder) add(t token) error {
+  if b.ended {
+    return nil
+  }
+  f := b.f
+  wasComment := b.lastComment != 0 && b.lastComment == t.line-1
+  b.lastComment = 0
+  switch t.kind {
+  case tokComment:
+    if v, name, ok := parseVarName(t.text); ok {
+      if f.names == nil {
+        f.names = map[int32]string{}
       }
-      if item == 0 {
-        clauses = append(clauses, currClause)
-        currClause = nil
-      } else {
-        currClause = append(currClause, item)
+      f.names[v] = name
+      // symbol comments neither start nor extend a comment block.
+      b.lastComment = 0
+      return nil
+    }
+    if wasComment {
+      if t.text != "" {
+        f.groupNames[b.currGroup] += " " + t.text
+      }
+    } else {
+      f.groupNames = append(f.groupNames, t.text)
+      b.currGroup = len(f.groupNames) - 1
+    }
+    b.lastComment = t.line
+  case tokHeader:
+    if f.vars != -1 {
+      return &ErrSyntax{t.line, t.col, "duplicate header"}
+    }
+    // literals before the header could not be checked against its variable count.
+    if len(f.clauses) > 0 || len(b.currClause) > 0 || b.currGCNFGroup != -1 {
+      return &ErrSyntax{t.line, t.col, "header after the first clause"}
+    }
+    b.currGroup = -1
+    f.vars, f.numClauses = t.lit, t.n
+    if !b.reserved && t.n > 0 {
+      b.reserve(min(t.n, maxHeaderReserve), 0, false)
+    }
+    if t.groups != -1 {
+      f.gcnfGroups = []int{}
+      f.numGCNFGroups = t.groups
+    }
+  case tokGroup:
+    switch {
+    case f.gcnfGroups == nil:
+      return &ErrSyntax{t.line, t.col, "clause group outside a gcnf file"}
+    case b.currGCNFGroup != -1 || len(b.currClause) > 0:
+      return &ErrSyntax{t.line, t.col, "clause group must come first in the clause"}
+    case t.lit > f.numGCNFGroups:
+      return &ErrSyntax{t.line, t.col, fmt.Sprintf("group %d exceeds declared %d", t.lit, f.numGCNFGroups)}
+    }
+    b.currGCNFGroup = t.lit
+    b.currLine = t.line
+  case tokLiteral:
+    if f.vars != -1 && abs(t.lit) > f.vars {
+      return &ErrVarOutOfRange{t.line, t.col, abs(t.lit), f.vars}
+    }
+    if b.currLine == 0 {
+      b.currLine = t.line
+    }
+    b.currClause = append(b.currClause, int32(t.lit))
+  case tokClauseEnd:
+    if f.gcnfGroups != nil {
+      if b.currGCNFGroup == -1 {
+        return &ErrSyntax{t.line, t.col, "clause without a group in a gcnf file"}
       }
+      f.gcnfGroups = append(f.gcnfGroups, b.currGCNFGroup)
+      b.currGCNFGroup = -1
+    }
+    c := b.currClause
+    if cap(b.arena)-len(b.arena) < len(c) {
+      // blocks double up to arenaBlock, so small inputs stay small.
+      b.arena = make([]int32, 0, max(len(c), min(arenaBlock, max(64, f.alloc.LiteralCapacity))))
+      f.alloc.LiteralBlocks++
+      f.alloc.LiteralCapacity += cap(b.arena)
+    }
+    start := len(b.arena)
+    b.arena = append(b.arena, c...)
+    f.alloc.Literals += len(c)
+    if len(f.clauses) == cap(f.clauses) && f.clauses != nil {
+      f.alloc.ClauseGrowths++
     }
+    // the clause's capacity ends with it, so appending to it can't overwrite the next one.
+    f.clauses = append(f.clauses, b.arena[start:len(b.arena):len(b.arena)])
+    f.groups = append(f.groups, b.currGroup)
+    if b.currLine == 0 {
+      // an empty clause is just its 0.
+      b.currLine = t.line
+    }
+    f.lines = append(f.lines, b.currLine)
+    b.currClause, b.currLine = c[:0], 0
+  case tokEnd:
+    b.ended = true
+  case tokInvalid:
+    return &ErrSyntax{t.line, t.col, t.text}
   }
-  var s strings.Builder
-  s.WriteString("graph {\n")
-  s.WriteString("  overlap = false;\n")
-  // literal -> []idx in clauses
-  literals := map[int][]int{}
-  for i, clause := range clauses {
-    sort.Ints(clause)
-    for _, lit := range clause {
-      literals[abs(lit)] = append(literals[abs(lit)], sign(lit) * i)
+  return nil
+}
+
+// finish returns the formula built, with a warning if its clause count disagrees with the
+// header.
+func (b *builder) finish() (*formula, error) {
+  f := b.f
+  if f.numClauses != -1 && f.numClauses != len(f.clauses) {
+    f.mismatch = &ErrHeaderMismatch{f.numClauses, len(f.clauses)}
+  }
+  return f, nil
+}
+
+// maxLine is the longest line the streaming parser accepts.
+const maxLine = 64 * 1024 * 1024
+
+// reportFunc is called periodically by the parsers with the number of bytes and clauses read.
+type reportFunc func(bytes int64, clauses int)
+
+// reportEvery is the number of lines between calls to a reportFunc.
+const reportEvery = 4096
+
+// parse reads a dimacs file line by line. If report is not nil it is called as parsing
+// progresses.
+func parse(r io.Reader, report reportFunc) (*formula, error) {
+  b := newBuilder()
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  var read int64
+  var toks []token
+  for scanner.Scan() {
+    line++
+    read += int64(len(scanner.Bytes())) + 1
+    if report != nil && line%reportEvery == 0 {
+      report(read, len(b.f.clauses))
+    }
+    toks = tokenizeLine(scanner.Text(), line, toks[:0])
+    for _, t := range toks {
+      if err := b.add(t); err != nil {
+        return nil, err
+      }
     }
   }
-  for i, clause := range clauses {
-    fmt.Fprintf(&s, "  %d [ label = \"%s\" ]\n", i, clauseString(clause))
+  if err := scanner.Err(); err != nil {
+    return nil, err
   }
-  for _, idxs := range literals {
-    if len(idxs) == 1 {
-      continue
+  return b.finish()
+}
+
+// progressBytes and progressClauses are the input sizes above which -progress reports parsing
+// and edge generation.
+const progressBytes = 4 * 1024 * 1024
+const progressClauses = 100000
+
+// progress reports how far a long operation is to w, at most a few times a second. A nil
+// *progress reports nothing, so callers need not check whether -progress was passed.
+type progress struct {
+  w io.Writer
+  name string
+  total int64
+  start, last time.Time
+  mu sync.Mutex
+}
+
+// newProgress returns a progress for an operation over total units reporting to the writer of
+// logger, or nil if -progress was not passed or total is below threshold.
+func newProgress(logger *log.Logger, name string, total, threshold int64) *progress {
+  if !*showProgress || total < threshold {
+    return nil
+  }
+  return &progress{w: logger.Writer(), name: name, total: total, start: time.Now()}
+}
+
+// update reports that done of the total units are complete. detail describes the work so far,
+// and is only called when a line is printed.
+func (p *progress) update(done int64, detail func() string) {
+  if p == nil {
+    return
+  }
+  p.mu.Lock()
+  defer p.mu.Unlock()
+  now := time.Now()
+  if now.Sub(p.last) < 200*time.Millisecond {
+    return
+  }
+  p.last = now
+  eta := "?"
+  if done > 0 {
+    elapsed := now.Sub(p.start)
+    eta = time.Duration(float64(elapsed) * float64(p.total-done) / float64(done)).Round(time.Second).String()
+  }
+  fmt.Fprintf(p.w, "\r%s: %5.1f%%, %s, ETA %s   ", p.name, 100*float64(done)/float64(p.total), detail(), eta)
+}
+
+func (p *progress) finish() {
+  if p == nil || p.last.IsZero() {
+    return
+  }
+  fmt.Fprintf(p.w, "\r%s: done in %s\033[K\n", p.name, time.Since(p.start).Round(time.Millisecond))
+}
+
+// eachLine calls fn with each line of data and its 1-based number, returning the number of
+// lines.
+func eachLine(data []byte, fn func(t string, line int) bool) int {
+  line := 0
+  for len(data) > 0 {
+    end := bytes.IndexByte(data, '\n')
+    next := end + 1
+    if end < 0 {
+      end, next = len(data), len(data)
     }
-    for idx, i := range idxs {
-      for _, j := range idxs[(idx+1):] {
-        if sign(i) == sign(j) {
-          fmt.Fprintf(&s, "  %d -- %d [ color=\"red\" ]\n", abs(i), abs(j))
-          continue
+    line++
+    if !fn(string(data[:end]), line) {
+      break
+    }
+    data = data[next:]
+  }
+  return line
+}
+
+// parseBytes parses data sequentially for a single worker. Otherwise it splits data into a
+// chunk of whole lines per worker. The workers tokenize their chunks concurrently, which is where
+// the time goes, and the tokens are then added to a builder in order, so the result is
+// identical to parse.
+func parseBytes(data []byte, workers int, report reportFunc) (*formula, error) {
+  b := newBuilder()
+  if workers <= 1 {
+    var err error
+    var toks []token
+    var read int64
+    eachLine(data, func(t string, line int) bool {
+      read += int64(len(t)) + 1
+      if report != nil && line%reportEvery == 0 {
+        report(read, len(b.f.clauses))
+      }
+      toks = tokenizeLine(t, line, toks[:0])
+      for _, tok := range toks {
+        if err = b.add(tok); err != nil {
+          return false
+        }
+      }
+      return true
+    })
+    if err != nil {
+      return nil, err
+    }
+    return b.finish()
+  }
+  var chunks [][]byte
+  size := len(data)/workers + 1
+  for len(data) > 0 {
+    end := size
+    if end >= len(data) {
+      end = len(data)
+    } else if i := bytes.IndexByte(data[end:], '\n'); i >= 0 {
+      end += i + 1
+    } else {
+      end = len(data)
+    }
+    chunks = append(chunks, data[:end])
+    data = data[end:]
+  }
+  toks := make([][]token, len(chunks))
+  lines := make([]int, len(chunks))
+  var wg sync.WaitGroup
+  var read int64
+  var clauses int64
+  for i, chunk := range chunks {
+    wg.Add(1)
+    go func(i int, chunk []byte) {
+      defer wg.Done()
+      var done int64
+      lines[i] = eachLine(chunk, func(t string, line int) bool {
+        done += int64(len(t)) + 1
+        n := len(toks[i])
+        toks[i] = tokenizeLine(t, line, toks[i])
+        for _, t := range toks[i][n:] {
+          if t.kind == tokClauseEnd {
+            atomic.AddInt64(&clauses, 1)
+          }
+        }
+        if report != nil && line%reportEvery == 0 {
+          report(atomic.AddInt64(&read, done), int(atomic.LoadInt64(&clauses)))
+          done = 0
         }
-        fmt.Fprintf(&s, "  %d -- %d [ color=\"blue\" ]\n", abs(i), abs(j))
+        return true
+      })
+    }(i, chunk)
+  }
+  wg.Wait()
+  // the tokens are all in memory, so count them to size the storage exactly.
+  clauseCount, literalCount := 0, 0
+count:
+  for i := range toks {
+    for _, t := range toks[i] {
+      switch t.kind {
+      case tokClauseEnd:
+        clauseCount++
+      case tokLiteral:
+        literalCount++
+      case tokEnd:
+        break count
+      }
+    }
+  }
+  b.reserve(clauseCount, literalCount, true)
+  offset := 0
+  for i := range toks {
+    for _, t := range toks[i] {
+      t.line += offset
+      if err := b.add(t); err != nil {
+        return nil, err
       }
     }
-    s.WriteByte('\n')
+    offset += lines[i]
+    toks[i] = nil
+  }
+  return b.finish()
+}
+
+// parallelParseSize is the file size above which parsing is split between goroutines, and
+// mmapSize the size above which the file is mapped into memory rather than read into a copy.
+const parallelParseSize = 16 * 1024 * 1024
+const mmapSize = 64 * 1024 * 1024
+
+// parseFile parses the file at path. Small files are streamed, larger ones are read whole and
+// parsed in parallel, and the largest are memory mapped to avoid copying them. If mapping fails
+// the file is read instead.
+func parseFile(logger *log.Logger, path string) (*formula, error) {
+  file, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+  info, err := file.Stat()
+  if err != nil {
+    return nil, err
+  }
+  size := info.Size()
+  var report reportFunc
+  if p := newProgress(logger, path, size, progressBytes); p != nil {
+    defer p.finish()
+    report = func(read int64, clauses int) {
+      p.update(read, func() string {
+        return fmt.Sprintf("%.1f/%.1f MB, %d clauses", float64(read)/1e6, float64(size)/1e6, clauses)
+      })
+    }
+  }
+  if size < parallelParseSize || (*parseThreads <= 1 && size < mmapSize) {
+    return parse(file, report)
+  }
+  if size >= mmapSize {
+    data, unmap, err := mapFile(file, size)
+    if err == nil {
+      defer unmap()
+      return parseBytes(data, *parseThreads, report)
+    }
+    logger.Printf("%s: could not map file, reading it instead: %v", path, err)
+  }
+  data, err := io.ReadAll(file)
+  if err != nil {
+    return nil, err
+  }
+  return parseBytes(data, *parseThreads, report)
+}
+
+// nodeAttrs returns the graphviz attributes of the node for clause i.
+func nodeAttrs(f *formula, i int) string {
+  label := clauseString(f.clauses[i], f.labelNames())
+  label = strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(label)
+  if *showLines {
+    label += fmt.Sprintf("\\nline %d", f.lines[i])
+  }
+  attrs := fmt.Sprintf("label = \"%s\"", label)
+  if f.classes != nil {
+    attrs += classAttrs[f.classes[i]]
+  }
+  if f.centrality != nil {
+    attrs += fmt.Sprintf(", centrality = \"%.6g\"", f.centrality[i])
+  }
+  return attrs
+}
+
+// writeClusters writes the clause nodes, placing clauses which share a comment block in a
+// subgraph cluster labeled by that comment.
+func writeClusters(s *bufio.Writer, f *formula) {
+  members := make([][]int, len(f.groupNames))
+  for i, g := range f.groups {
+    if g == -1 {
+      fmt.Fprintf(s, "  %d [ %s ]\n", i, nodeAttrs(f, i))
+      continue
+    }
+    members[g] = append(members[g], i)
+  }
+  for g, idxs := range members {
+    if len(idxs) == 0 {
+      continue
+    }
+    fmt.Fprintf(s, "  subgraph cluster_%d {\n", g)
+    fmt.Fprintf(s, "    label = %q;\n", f.groupNames[g])
+    for _, i := range idxs {
+      fmt.Fprintf(s, "    %d [ %s ]\n", i, nodeAttrs(f, i))
+    }
+    s.WriteString("  }\n")
   }
+}
+
+// clusterGCNF replaces the comment blocks of f by its GCNF groups, so that writeClusters places
+// the clauses of each group in one cluster.
+func clusterGCNF(f *formula) {
+  f.groupNames = make([]string, f.numGCNFGroups+1)
+  for g := range f.groupNames {
+    f.groupNames[g] = fmt.Sprintf("group %d", g)
+  }
+  f.groupNames[0] = "hard"
+  f.groups = f.gcnfGroups
+}
 
+// Redundancy classes of clauses for -classify, in order of precedence.
+const (
+  irredundant = iota
+  tautological
+  subsumed
+  blocked
+  unitImplied
+)
+
+var classNames = []string{"irredundant", "tautological", "subsumed", "blocked", "unit implied"}
+
+// classAttrs are the node borders used for each class.
+var classAttrs = []string{
+  "",
+  ", style = dotted",
+  ", style = dashed",
+  ", style = bold",
+  ", peripheries = 2",
+}
 
-  s.WriteByte('}')
-  fmt.Println(s.String())
+// classify assigns each clause a redundancy class. Clauses are eliminated one at a time and
+// later checks only consider the clauses which remain, so the irredundant clauses form an
+// equisatisfiable core: tautologies and subsumed clauses are dropped first, then blocked
+// clauses, then clauses implied by unit propagation on the rest.
+//
+// For GCNF, groups holds the group of each clause, and the core must be one for every set of
+// groups kept with the hard clauses. So only hard clauses and those of the same group may subsume
+// a clause or propagate to imply it, and a blocked clause must be blocked by every other clause,
+// including those eliminated, which may be missing from a set of groups.
+func classify(clauses [][]int32, groups []int) []int {
+  classes := make([]int, len(clauses))
+  removed := make([]bool, len(clauses))
+  occurs := occurrences(clauses)
+  // justifies reports whether clause d may be used to eliminate clause i.
+  justifies := func(d, i int) bool {
+    return groups == nil || groups[d] == 0 || groups[d] == groups[i]
+  }
+  contains := func(c []int32, lit int32) bool {
+    for _, l := range c {
+      if l == lit {
+        return true
+      }
+    }
+    return false
+  }
+  for i, c := range clauses {
+    for _, l := range c {
+      if contains(c, -l) {
+        classes[i], removed[i] = tautological, true
+        break
+      }
+    }
+  }
+  // d subsumes c if every literal of d is in c. Of two equal clauses the later one is the
+  // subsumed one.
+  subsumes := func(d, c int) bool {
+    if len(clauses[d]) > len(clauses[c]) || (len(clauses[d]) == len(clauses[c]) && d > c) {
+      return false
+    }
+    for _, l := range clauses[d] {
+      if !contains(clauses[c], l) {
+        return false
+      }
+    }
+    return true
+  }
+  for i, c := range clauses {
+    if removed[i] {
+      continue
+    }
+    for _, l := range c {
+      for _, o := range occurs.of(l) {
+        d := o.Clause
+        if o.Matches(l) && d != i && !removed[d] && justifies(d, i) && subsumes(d, i) {
+          classes[i], removed[i] = subsumed, true
+          break
+        }
+      }
+      if removed[i] {
+        break
+      }
+    }
+  }
+  // c is blocked on l if every resolvent on l with a remaining clause is a tautology.
+  isBlocked := func(i int) bool {
+    for _, l := range clauses[i] {
+      allTaut := true
+      for _, o := range occurs.of(l) {
+        d := o.Clause
+        if !o.Matches(-l) || (removed[d] && groups == nil) {
+          continue
+        }
+        taut := false
+        for _, m := range clauses[d] {
+          if m != -l && contains(clauses[i], -m) {
+            taut = true
+            break
+          }
+        }
+        if !taut {
+          allTaut = false
+          break
+        }
+      }
+      if allTaut {
+        return true
+      }
+    }
+    return false
+  }
+  for i := range clauses {
+    if !removed[i] && isBlocked(i) {
+      classes[i], removed[i] = blocked, true
+    }
+  }
+  for i := range clauses {
+    removed[i] = true
+    uses := func(d int) bool { return !removed[d] && justifies(d, i) }
+    if classes[i] == irredundant && !unitPropagates(clauses, occurs, uses, clauses[i]) {
+      removed[i] = false
+      continue
+    }
+    if classes[i] == irredundant {
+      classes[i] = unitImplied
+    }
+  }
+  return classes
+}
+
+// unitPropagates reports whether unit propagation on the clauses it uses reaches a conflict after
+// assigning every literal of c false.
+func unitPropagates(clauses [][]int32, occurs Occurrences, uses func(d int) bool, c []int32) bool {
+  value := map[int32]bool{}
+  var trail []int32
+  for _, l := range c {
+    if v, ok := value[varOf(l)]; ok {
+      if v == (l > 0) {
+        // c is a tautology.
+        return true
+      }
+      continue
+    }
+    value[varOf(l)] = l < 0
+    trail = append(trail, -l)
+  }
+  // returns true on conflict, and assigns the literal of a unit clause.
+  visit := func(d int) bool {
+    unassigned, unit := 0, int32(0)
+    for _, l := range clauses[d] {
+      v, ok := value[varOf(l)]
+      if !ok {
+        unassigned++
+        unit = l
+      } else if v == (l > 0) {
+        return false
+      }
+    }
+    switch unassigned {
+    case 0:
+      return true
+    case 1:
+      value[varOf(unit)] = unit > 0
+      trail = append(trail, unit)
+    }
+    return false
+  }
+  for d := range clauses {
+    if uses(d) && len(clauses[d]) <= 1 && visit(d) {
+      return true
+    }
+  }
+  for i := 0; i < len(trail); i++ {
+    for _, o := range occurs.of(trail[i]) {
+      if o.Matches(-trail[i]) && uses(o.Clause) && visit(o.Clause) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+// writeDimacs writes clauses as a dimacs file, or as GCNF with numGroups groups if groups is not
+// nil. If lines is not nil each clause is preceded by a `c line <n>` comment giving its line in
+// the input.
+func writeDimacs(w io.Writer, clauses [][]int32, groups []int, numGroups int, lines []int) error {
+  b := bufio.NewWriter(w)
+  vars := 0
+  for _, c := range clauses {
+    for _, l := range c {
+      if v := int(varOf(l)); v > vars {
+        vars = v
+      }
+    }
+  }
+  if groups == nil {
+    fmt.Fprintf(b, "p cnf %d %d\n", vars, len(clauses))
+  } else {
+    fmt.Fprintf(b, "p gcnf %d %d %d\n", vars, len(clauses), numGroups)
+  }
+  for i, c := range clauses {
+    if lines != nil {
+      fmt.Fprintf(b, "c line %d\n", lines[i])
+    }
+    if groups != nil {
+      fmt.Fprintf(b, "{%d} ", groups[i])
+    }
+    for _, l := range c {
+      fmt.Fprintf(b, "%d ", l)
+    }
+    b.WriteString("0\n")
+  }
+  return b.Flush()
+}
+
+// writeCore writes the irredundant clauses of f to path.
+func writeCore(path string, f *formula) error {
+  var core [][]int32
+  var groups, lines []int
+  for i, c := range f.clauses {
+    if f.classes[i] == irredundant {
+      core = append(core, c)
+      if f.gcnfGroups != nil {
+        groups = append(groups, f.gcnfGroups[i])
+      }
+      if *showLines {
+        lines = append(lines, f.lines[i])
+      }
+    }
+  }
+  if f.gcnfGroups != nil && groups == nil {
+    groups = []int{}
+  }
+  out, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  if err := writeDimacs(out, core, groups, f.numGCNFGroups, lines); err != nil {
+    out.Close()
+    return err
+  }
+  return out.Close()
+}
+
+// Occurrence is a clause containing a variable, and whether it contains it negated. This
+// replaces encoding the polarity in the sign of the clause index, which cannot represent a
+// negated occurrence in clause 0.
+type Occurrence struct {
+  Clause int
+  Neg bool
+}
+
+// Matches reports whether the occurrence is of literal l, given that it is of l's variable.
+func (o Occurrence) Matches(l int32) bool {
+  return o.Neg == (l < 0)
+}
+
+// Occurrences lists, for each variable, the clauses containing it in clause order.
+type Occurrences [][]Occurrence
+
+// occurrences builds the lists in two passes over chunks of clauses, one per worker: the first
+// counts each chunk's occurrences of each variable, and after a merge turning the counts into
+// offsets the second fills them in. A chunk's slots follow those of earlier chunks, so the
+// lists are in clause order whatever the number of workers.
+func occurrences(clauses [][]int32) Occurrences {
+  workers := *graphThreads
+  if workers < 1 || len(clauses) < parallelGraphClauses {
+    workers = 1
+  }
+  size := len(clauses)/workers + 1
+  counts := make([][]int, workers)
+  parallel(workers, func(w int) {
+    for _, clause := range clauses[min(w*size, len(clauses)):min((w+1)*size, len(clauses))] {
+      for _, l := range clause {
+        v := int(varOf(l))
+        for v >= len(counts[w]) {
+          counts[w] = append(counts[w], 0)
+        }
+        counts[w][v]++
+      }
+    }
+  })
+  vars := 0
+  for _, c := range counts {
+    vars = max(vars, len(c))
+  }
+  occurs := make(Occurrences, vars)
+  total := 0
+  for _, c := range counts {
+    for _, n := range c {
+      total += n
+    }
+  }
+  all := make([]Occurrence, total)
+  off := 0
+  for v := range occurs {
+    start := off
+    for _, c := range counts {
+      if v < len(c) {
+        c[v], off = off, off+c[v]
+      }
+    }
+    occurs[v] = all[start:off:off]
+  }
+  parallel(workers, func(w int) {
+    next := counts[w]
+    lo := min(w*size, len(clauses))
+    for i, clause := range clauses[lo:min((w+1)*size, len(clauses))] {
+      for _, l := range clause {
+        v := varOf(l)
+        all[next[v]] = Occurrence{lo + i, l < 0}
+        next[v]++
+      }
+    }
+  })
+  return occurs
+}
+
+// parallel calls fn with 0..workers-1 in as many goroutines, and waits for them.
+func parallel(workers int, fn func(w int)) {
+  if workers == 1 {
+    fn(0)
+    return
+  }
+  var wg sync.WaitGroup
+  for w := 0; w < workers; w++ {
+    wg.Add(1)
+    go func(w int) {
+      defer wg.Done()
+      fn(w)
+    }(w)
+  }
+  wg.Wait()
+}
+
+// of returns the occurrences of the variable of literal l.
+func (o Occurrences) of(l int32) []Occurrence {
+  if v := int(varOf(l)); v < len(o) {
+    return o[v]
+  }
+  return nil
+}
+
+// forEachEdge calls fn with each edge of the clause graph of f, ordered by the lower clause and
+// then by variable. Two clauses sharing several variables are joined by at most one edge of each
+// polarity, carrying the first such variable, which is detected by stamping the clauses already
+// joined to the current one instead of keeping a set of every edge.
+//
+// Large formulas are split into batches of lower clauses, whose edges are generated by
+// -graph-threads workers with their own stamps and passed to fn batch by batch in order, so fn
+// sees the same edges in the same order as with one worker. At most a few batches per worker
+// are held waiting for fn.
+func forEachEdge(logger *log.Logger, f *formula, fn func(edge)) {
+  forEachEdgeExcept(logger, f, nil, fn)
+}
+
+// forEachEdgeExcept is forEachEdge ignoring the variables v with skip[v] != 0, so two clauses
+// are only joined if they share another variable. skip may be nil or shorter than the
+// variables.
+func forEachEdgeExcept(logger *log.Logger, f *formula, skip []int, fn func(edge)) {
+  occurs := occurrences(f.clauses)
+  p := newProgress(logger, "edges", int64(len(f.clauses)), progressClauses)
+  defer p.finish()
+  report := func(a int) {
+    p.update(int64(a), func() string { return fmt.Sprintf("%d/%d clauses", a, len(f.clauses)) })
+  }
+  workers := *graphThreads
+  if workers <= 1 || len(f.clauses) < parallelGraphClauses {
+    stamp := newStamps(len(f.clauses))
+    for a := range f.clauses {
+      if a%1024 == 0 {
+        report(a)
+      }
+      edgesFrom(f, occurs, skip, stamp, a, fn)
+    }
+    return
+  }
+  // each worker stamps every clause, so large inputs get fewer workers.
+  workers = max(1, min(workers, edgeStampBytes/(8*len(f.clauses))))
+  batches := (len(f.clauses) + edgeBatch - 1) / edgeBatch
+  results := make([]chan []edge, batches)
+  for i := range results {
+    results[i] = make(chan []edge, 1)
+  }
+  // a worker takes a token before claiming a batch, and fn's caller returns it once the batch
+  // is passed on. Batches are claimed in order, so the next one fn needs is always claimed.
+  tokens := make(chan struct{}, 4*workers)
+  next := int64(-1)
+  for w := 0; w < workers; w++ {
+    go func() {
+      stamp := newStamps(len(f.clauses))
+      for {
+        tokens <- struct{}{}
+        i := int(atomic.AddInt64(&next, 1))
+        if i >= batches {
+          <-tokens
+          return
+        }
+        var out []edge
+        for a := i * edgeBatch; a < min((i+1)*edgeBatch, len(f.clauses)); a++ {
+          edgesFrom(f, occurs, skip, stamp, a, func(e edge) { out = append(out, e) })
+        }
+        results[i] <- out
+      }
+    }()
+  }
+  for i, r := range results {
+    report(i * edgeBatch)
+    for _, e := range <-r {
+      fn(e)
+    }
+    <-tokens
+  }
+}
+
+// parallelGraphClauses is the number of clauses above which occurrence lists and edges are
+// built by several goroutines, and edgeBatch the number of lower clauses in a batch of edges.
+const parallelGraphClauses = 100000
+const edgeBatch = 1024
+
+// edgeStampBytes bounds the memory of the stamps of all workers building edges, 8 bytes per
+// clause each.
+const edgeStampBytes = 1 << 30
+
+// stamps is indexed by polarity and then clause, holding a+1 once the clause is joined to a by
+// an edge of that polarity.
+type stamps [2][]int32
+
+func newStamps(n int) *stamps {
+  return &stamps{make([]int32, n), make([]int32, n)}
+}
+
+// edgesFrom calls fn with the edges from clause a to later clauses.
+func edgesFrom(f *formula, occurs Occurrences, skip []int, stamp *stamps, a int, fn func(edge)) {
+  for _, l := range f.clauses[a] {
+    if v := int(varOf(l)); v < len(skip) && skip[v] != 0 {
+      continue
+    }
+    occs := occurs.of(l)
+    // occurrences are in clause order, so skip to the clauses after a.
+    start := sort.Search(len(occs), func(i int) bool { return occs[i].Clause > a })
+    for _, b := range occs[start:] {
+      same := b.Matches(l)
+      k := 0
+      if same {
+        k = 1
+      }
+      if stamp[k][b.Clause] == int32(a+1) {
+        continue
+      }
+      stamp[k][b.Clause] = int32(a + 1)
+      fn(edge{a, b.Clause, int(varOf(l)), same})
+    }
+  }
+}
+
+// sortEdges sorts edges from the same clause by the clause they join, with same polarity edges
+// first, for -canonical.
+func sortEdges(edges []edge) {
+  sort.Slice(edges, func(i, j int) bool {
+    if edges[i].b != edges[j].b {
+      return edges[i].b < edges[j].b
+    }
+    return edges[i].same && !edges[j].same
+  })
+}
+
+// mayExceed reports whether the clause graph of f could have more than n nodes and edges, by
+// bounding the edges through each variable by the pairs of its occurrences.
+func mayExceed(f *formula, n int) bool {
+  total := len(f.clauses)
+  var counts []int
+  for _, c := range f.clauses {
+    for _, l := range c {
+      v := int(varOf(l))
+      for v >= len(counts) {
+        counts = append(counts, 0)
+      }
+      counts[v]++
+    }
+  }
+  for _, k := range counts {
+    total += k * (k - 1) / 2
+    if total > n {
+      return true
+    }
+  }
+  return false
+}
+
+// shardedGraph writes the clause graph of f like graph, but declares each clause's node just
+// before its edges, and starts a new shard at the first clause boundary after -shard nodes and
+// edges. The first shard is written to w, the file at out. If there are more, it is renamed
+// to the first shard's name, and an index of the shards is written next to them.
+func shardedGraph(logger *log.Logger, w io.Writer, out string, f *formula) error {
+  hubs := hubVars(f)
+  names := f.labelNames()
+  var hubNodes []string
+  for v, n := range hubs {
+    if n != 0 {
+      label := strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(litString(int32(v), names))
+      hubNodes = append(hubNodes, fmt.Sprintf("  h%d [ label = \"%s (%d)\", shape = diamond ]\n", v, label, n))
+    }
+  }
+  base := strings.TrimSuffix(out, ".dot")
+  shardPath := func(k int) string { return fmt.Sprintf("%s-%03d.dot", base, k) }
+  type shard struct {
+    first, last, nodes, edges int
+  }
+  var shards []shard
+  var file *os.File
+  var s *bufio.Writer
+  var err error
+  open := func(a int) {
+    if len(shards) > 0 {
+      file, err = os.Create(shardPath(len(shards) + 1))
+      if err != nil {
+        return
+      }
+      w = file
+    }
+    shards = append(shards, shard{first: a, last: a - 1})
+    s = bufio.NewWriter(w)
+    s.WriteString("graph {\n")
+    s.WriteString("  overlap = false;\n")
+    for _, h := range hubNodes {
+      s.WriteString(h)
+    }
+  }
+  closeShard := func() {
+    if *legend {
+      writeLegend(s, hubs != nil)
+    }
+    s.WriteString("}\n")
+    if ferr := s.Flush(); err == nil {
+      err = ferr
+    }
+    if file != nil {
+      if cerr := file.Close(); err == nil {
+        err = cerr
+      }
+      file = nil
+    }
+  }
+  var pending []edge
+  next := 0
+  // emit writes the nodes of the clauses before a, each followed by its edges, which are in
+  // pending for the last of them.
+  emit := func(a int) {
+    for ; next < a && err == nil; next++ {
+      if len(shards) == 0 {
+        open(next)
+      } else if sh := shards[len(shards)-1]; sh.nodes+sh.edges >= *shardSize {
+        closeShard()
+        if err == nil {
+          open(next)
+        }
+      }
+      if err != nil {
+        return
+      }
+      sh := &shards[len(shards)-1]
+      fmt.Fprintf(s, "  %d [ %s ]\n", next, nodeAttrs(f, next))
+      sh.last, sh.nodes = next, sh.nodes+1
+      if len(pending) > 0 && pending[0].a == next {
+        if *canonical {
+          sortEdges(pending)
+        }
+        for _, e := range pending {
+          fmt.Fprintf(s, "  %d -- %d%s\n", e.a, e.b, withEdgeLabel(edgeAttrs(e.v, e.same), f, e))
+        }
+        sh.edges += len(pending)
+        pending = pending[:0]
+      }
+      if hubs != nil {
+        for _, l := range f.clauses[next] {
+          if v := varOf(l); hubs[v] != 0 {
+            fmt.Fprintf(s, "  %d -- h%d%s\n", next, v, factorEdgeAttrs(int(v), l < 0))
+            sh.edges++
+          }
+        }
+      }
+    }
+  }
+  forEachEdgeExcept(logger, f, hubs, func(e edge) {
+    if len(pending) > 0 && pending[0].a != e.a {
+      emit(pending[0].a + 1)
+    }
+    if len(pending) == 0 {
+      emit(e.a)
+    }
+    pending = append(pending, e)
+  })
+  emit(len(f.clauses))
+  if len(shards) == 0 {
+    open(0)
+  }
+  closeShard()
+  if err != nil || len(shards) == 1 {
+    return err
+  }
+  if err := os.Rename(out, shardPath(1)); err != nil {
+    return err
+  }
+  index, err := os.Create(base + "-index.tsv")
+  if err != nil {
+    return err
+  }
+  b := bufio.NewWriter(index)
+  b.WriteString("file\tfirst\tlast\tnodes\tedges\n")
+  for k, sh := range shards {
+    fmt.Fprintf(b, "%s\t%d\t%d\t%d\t%d\n", filepath.Base(shardPath(k+1)), sh.first, sh.last, sh.nodes, sh.edges)
+  }
+  err = b.Flush()
+  if cerr := index.Close(); err == nil {
+    err = cerr
+  }
+  logger.Printf("%s: wrote %d shards, listed in %s", out, len(shards), base+"-index.tsv")
+  return err
+}
+
+// hubVars returns the number of occurrences of each variable occurring in more than -hub
+// clauses, and 0 for the others, or nil if there are none.
+func hubVars(f *formula) []int {
+  if *hubThreshold <= 0 {
+    return nil
+  }
+  var counts []int
+  for _, c := range f.clauses {
+    for _, l := range c {
+      v := int(varOf(l))
+      for v >= len(counts) {
+        counts = append(counts, 0)
+      }
+      counts[v]++
+    }
+  }
+  found := false
+  for v, n := range counts {
+    if n > *hubThreshold {
+      found = true
+    } else {
+      counts[v] = 0
+    }
+  }
+  if !found {
+    return nil
+  }
+  return counts
+}
+
+// graph streams the clause graph of f to w as a graphviz graph. If edges is not nil, the edges
+// are also appended to it.
+func graph(logger *log.Logger, w io.Writer, f *formula, edges *[]edge) error {
+  s := bufio.NewWriter(w)
+  s.WriteString("graph {\n")
+  s.WriteString("  overlap = false;\n")
+  if *clusterComments || f.gcnfGroups != nil {
+    writeClusters(s, f)
+  } else {
+    for i := range f.clauses {
+      fmt.Fprintf(s, "  %d [ %s ]\n", i, nodeAttrs(f, i))
+    }
+  }
+  var hubs []int
+  if edges == nil {
+    hubs = hubVars(f)
+  }
+  names := f.labelNames()
+  for v, n := range hubs {
+    if n != 0 {
+      label := strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(litString(int32(v), names))
+      fmt.Fprintf(s, "  h%d [ label = \"%s (%d)\", shape = diamond ]\n", v, label, n)
+    }
+  }
+  // attributes only depend on the polarity and the variable's palette entry.
+  var attrs [2][]string
+  for k := range attrs {
+    attrs[k] = make([]string, len(palette))
+    for v := range palette {
+      attrs[k][v] = edgeAttrs(v, k == 1)
+    }
+  }
+  var buf []byte
+  write := func(e edge) {
+    k := 0
+    if e.same {
+      k = 1
+    }
+    buf = append(buf[:0], "  "...)
+    buf = strconv.AppendInt(buf, int64(e.a), 10)
+    buf = append(buf, " -- "...)
+    buf = strconv.AppendInt(buf, int64(e.b), 10)
+    if *edgeLabels == "none" {
+      buf = append(buf, attrs[k][e.v%len(palette)]...)
+    } else {
+      buf = append(buf, withEdgeLabel(attrs[k][e.v%len(palette)], f, e)...)
+    }
+    buf = append(buf, '\n')
+    s.Write(buf)
+    if edges != nil {
+      *edges = append(*edges, e)
+    }
+  }
+  if !*canonical {
+    forEachEdgeExcept(logger, f, hubs, write)
+  } else {
+    // edges arrive ordered by the lower clause, so only those of one clause need sorting.
+    var pending []edge
+    flush := func() {
+      sortEdges(pending)
+      for _, e := range pending {
+        write(e)
+      }
+      pending = pending[:0]
+    }
+    forEachEdgeExcept(logger, f, hubs, func(e edge) {
+      if len(pending) > 0 && pending[0].a != e.a {
+        flush()
+      }
+      pending = append(pending, e)
+    })
+    flush()
+  }
+  if hubs != nil {
+    for i, c := range f.clauses {
+      for _, l := range c {
+        if v := varOf(l); hubs[v] != 0 {
+          fmt.Fprintf(s, "  %d -- h%d%s\n", i, v, factorEdgeAttrs(int(v), l < 0))
+        }
+      }
+    }
+  }
+  if *legend {
+    writeLegend(s, hubs != nil)
+  }
+
+
+  s.WriteString("}\n")
+  return s.Flush()
+}
+
+// centrality scores the nodes of the graph adj, normalized to sum to 1. Eigenvector centrality
+// iterates A + I rather than A, as the plain power iteration oscillates on bipartite graphs
+// such as the factor graph.
+func centrality(adj [][]int, kind string) []float64 {
+  n := len(adj)
+  score := make([]float64, n)
+  next := make([]float64, n)
+  for i := range score {
+    score[i] = 1 / float64(n)
+  }
+  const damping = 0.85
+  for iter := 0; iter < 100; iter++ {
+    if kind == "pagerank" {
+      // the rank of nodes without edges is spread over every node.
+      dangling := 0.0
+      for i, ns := range adj {
+        if len(ns) == 0 {
+          dangling += score[i]
+        }
+      }
+      for i := range next {
+        next[i] = (1-damping+damping*dangling)/float64(n)
+      }
+      for i, ns := range adj {
+        for _, j := range ns {
+          next[j] += damping * score[i] / float64(len(ns))
+        }
+      }
+    } else {
+      for i, ns := range adj {
+        next[i] = score[i]
+        for _, j := range ns {
+          next[i] += score[j]
+        }
+      }
+    }
+    sum := 0.0
+    for _, x := range next {
+      sum += x
+    }
+    for i := range next {
+      next[i] /= sum
+    }
+    score, next = next, score
+  }
+  return score
+}
+
+// variableGraph returns the graph joining variables which share a clause, with variable v as
+// node v-1.
+func variableGraph(f *formula) [][]int {
+  occurs := occurrences(f.clauses)
+  adj := make([][]int, max(len(occurs)-1, 0))
+  // stamp[u] is v once u has been added as a neighbour of v.
+  stamp := make([]int, len(occurs))
+  for v := 1; v < len(occurs); v++ {
+    stamp[v] = v
+    for _, lit := range [2]int32{int32(v), int32(-v)} {
+      for _, o := range occurs.of(lit) {
+        for _, l := range f.clauses[o.Clause] {
+          if u := int(varOf(l)); stamp[u] != v {
+            stamp[u] = v
+            adj[v-1] = append(adj[v-1], u-1)
+          }
+        }
+      }
+    }
+  }
+  return adj
+}
+
+// factorAdjacency returns the factor graph, with clause i as node i and variable v as node
+// len(f.clauses)+v-1.
+func factorAdjacency(f *formula) [][]int {
+  var maxVar int32
+  for _, c := range f.clauses {
+    for _, l := range c {
+      maxVar = max(maxVar, varOf(l))
+    }
+  }
+  adj := make([][]int, len(f.clauses)+int(maxVar))
+  for i, c := range f.clauses {
+    for _, l := range c {
+      v := len(f.clauses) + int(varOf(l)) - 1
+      adj[i] = append(adj[i], v)
+      adj[v] = append(adj[v], i)
+    }
+  }
+  return adj
+}
+
+// annotateCentrality sets the centrality scores of f's nodes for the graph being drawn, and
+// logs the most central variables for -top.
+func annotateCentrality(logger *log.Logger, path string, f *formula) {
+  kind := *centralityKind
+  if kind != "none" {
+    switch *mode {
+    case "factor":
+      scores := centrality(factorAdjacency(f), kind)
+      f.centrality = scores[:len(f.clauses)]
+      // varCentrality is indexed by variable, so leave a zero for variable 0.
+      f.varCentrality = append([]float64{0}, scores[len(f.clauses):]...)
+    case "var":
+      f.varCentrality = append([]float64{0}, centrality(variableGraph(f), kind)...)
+    default:
+      adj, _ := graphSummary(logger, f)
+      f.centrality = centrality(adj, kind)
+    }
+  }
+  if *topVars <= 0 {
+    return
+  }
+  if kind == "none" {
+    kind = "pagerank"
+  }
+  scores := centrality(variableGraph(f), kind)
+  vars := make([]int, len(scores))
+  for i := range vars {
+    vars[i] = i
+  }
+  sort.SliceStable(vars, func(i, j int) bool { return scores[vars[i]] > scores[vars[j]] })
+  names := f.labelNames()
+  for rank, i := range vars[:min(*topVars, len(vars))] {
+    logger.Printf("%s: central variable %d: %s (%.6g)", path, rank+1, litString(int32(i+1), names), scores[i])
+  }
+}
+
+// communities assigns each node of the graph adj to a community by label propagation: every
+// node starts in its own community, then repeatedly joins the most common community among its
+// neighbours, with ties between other communities broken towards the smaller label so the
+// result is deterministic. The communities are numbered from 0 in order of their first node.
+func communities(adj [][]int) []int {
+  label := make([]int, len(adj))
+  for i := range label {
+    label[i] = i
+  }
+  count := make([]int, len(adj))
+  for round := 0; round < 50; round++ {
+    changed := false
+    for i, ns := range adj {
+      // a node only leaves its community for a strictly more common one, which keeps ties
+      // from flooding the graph with the smallest label.
+      best := label[i]
+      for _, j := range ns {
+        count[label[j]]++
+      }
+      for _, j := range ns {
+        l := label[j]
+        if count[l] > count[best] || (count[l] == count[best] && l < best && count[label[i]] < count[l]) {
+          best = l
+        }
+      }
+      for _, j := range ns {
+        count[label[j]] = 0
+      }
+      if best != label[i] {
+        label[i] = best
+        changed = true
+      }
+    }
+    if !changed {
+      break
+    }
+  }
+  ids := map[int]int{}
+  for i, l := range label {
+    id, ok := ids[l]
+    if !ok {
+      id = len(ids)
+      ids[l] = id
+    }
+    label[i] = id
+  }
+  return label
+}
+
+// writeCommunities writes the clauses of each community of f's clause graph to a file, and a
+// report of the variables each community shares with others.
+func writeCommunities(logger *log.Logger, dir, path string, f *formula) error {
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return err
+  }
+  adj, _ := graphSummary(logger, f)
+  label := communities(adj)
+  n := 0
+  for _, l := range label {
+    n = max(n, l+1)
+  }
+  members := make([][]int, n)
+  for i, l := range label {
+    members[l] = append(members[l], i)
+  }
+  // owner[v] is the community variable v was first seen in, or -2 once seen in two.
+  owner := map[int32]int{}
+  for i, c := range f.clauses {
+    for _, l := range c {
+      v := varOf(l)
+      if o, ok := owner[v]; !ok {
+        owner[v] = label[i]
+      } else if o != label[i] {
+        owner[v] = -2
+      }
+    }
+  }
+  base := filepath.Base(path)
+  name := strings.TrimSuffix(base, filepath.Ext(base))
+  report, err := os.Create(filepath.Join(dir, name+".interface.txt"))
+  if err != nil {
+    return err
+  }
+  r := bufio.NewWriter(report)
+  names := f.labelNames()
+  for k, idxs := range members {
+    clauses := make([][]int32, len(idxs))
+    var groups, lines []int
+    seen := map[int32]bool{}
+    var vars, iface []int32
+    for j, i := range idxs {
+      clauses[j] = f.clauses[i]
+      if f.gcnfGroups != nil {
+        groups = append(groups, f.gcnfGroups[i])
+      }
+      if *showLines {
+        lines = append(lines, f.lines[i])
+      }
+      for _, l := range f.clauses[i] {
+        if v := varOf(l); !seen[v] {
+          seen[v] = true
+          vars = append(vars, v)
+          if owner[v] == -2 {
+            iface = append(iface, v)
+          }
+        }
+      }
+    }
+    out, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s.community%d.cnf", name, k)))
+    if err != nil {
+      report.Close()
+      return err
+    }
+    err = writeDimacs(out, clauses, groups, f.numGCNFGroups, lines)
+    if cerr := out.Close(); err == nil {
+      err = cerr
+    }
+    if err != nil {
+      report.Close()
+      return err
+    }
+    sortLits(iface)
+    ifaceNames := make([]string, len(iface))
+    for j, v := range iface {
+      ifaceNames[j] = litString(v, names)
+    }
+    fmt.Fprintf(r, "community %d: %d clauses, %d variables, %d interface variables: %s\n", k, len(clauses), len(vars), len(iface), strings.Join(ifaceNames, " "))
+  }
+  err = r.Flush()
+  if cerr := report.Close(); err == nil {
+    err = cerr
+  }
+  if err == nil {
+    logger.Printf("%s: wrote %d communities to %s", path, n, dir)
+  }
+  return err
+}
+
+// separatorCandidates is the number of variables, those in the most clauses, which -separators
+// considers removing at each step.
+const separatorCandidates = 64
+
+// split is the clause graph of a formula with some variables removed, which only joins clauses
+// through the remaining ones.
+type split struct {
+  // label[i] is the component of clause i, numbered from 0 in order of their first clause, or -1
+  // if all of its variables were removed.
+  label []int
+  // sizes are the numbers of clauses of each component.
+  sizes []int
+  largest int
+}
+
+// splitScore is how much a split disconnects the graph, kept for each candidate instead of the
+// whole split.
+type splitScore struct {
+  largest, components int
+}
+
+// worse reports whether s disconnects the graph less than t: its largest component is bigger,
+// or as big with fewer components.
+func (s splitScore) worse(t splitScore) bool {
+  if s.largest != t.largest {
+    return s.largest > t.largest
+  }
+  return s.components < t.components
+}
+
+// splitWithout returns the components of the clause graph of f without the variables removed,
+// and without v if it is not 0. parent is scratch space of a slot per clause.
+func splitWithout(f *formula, occurs Occurrences, removed []bool, v int, parent []int) *split {
+  for i := range parent {
+    parent[i] = i
+  }
+  find := func(i int) int {
+    for parent[i] != i {
+      parent[i] = parent[parent[i]]
+      i = parent[i]
+    }
+    return i
+  }
+  kept := make([]bool, len(f.clauses))
+  for u, occ := range occurs {
+    if removed[u] || u == v || len(occ) == 0 {
+      continue
+    }
+    root := find(occ[0].Clause)
+    for _, o := range occ {
+      kept[o.Clause] = true
+      if r := find(o.Clause); r != root {
+        parent[r] = root
+      }
+    }
+  }
+  s := &split{label: make([]int, len(f.clauses))}
+  // ids[r] is the component of root r plus one, so the zero value means none yet.
+  ids := make([]int, len(f.clauses))
+  for i := range f.clauses {
+    if !kept[i] {
+      s.label[i] = -1
+      continue
+    }
+    r := find(i)
+    if ids[r] == 0 {
+      s.sizes = append(s.sizes, 0)
+      ids[r] = len(s.sizes)
+    }
+    id := ids[r] - 1
+    s.label[i] = id
+    s.sizes[id]++
+    s.largest = max(s.largest, s.sizes[id])
+  }
+  return s
+}
+
+// separators greedily picks k variables whose removal most disconnects the clause graph of f,
+// each time removing the candidate which leaves the smallest largest component, and returns
+// them in order with the split they leave together.
+func separators(logger *log.Logger, path string, f *formula, k int) ([]int32, *split) {
+  occurs := occurrences(f.clauses)
+  var candidates []int
+  for v := range occurs {
+    if len(occurs[v]) > 0 {
+      candidates = append(candidates, v)
+    }
+  }
+  sort.SliceStable(candidates, func(i, j int) bool {
+    return len(occurs[candidates[i]]) > len(occurs[candidates[j]])
+  })
+  candidates = candidates[:min(len(candidates), separatorCandidates)]
+  workers := max(1, min(*graphThreads, len(candidates)))
+  parents := make([][]int, workers)
+  for w := range parents {
+    parents[w] = make([]int, len(f.clauses))
+  }
+  removed := make([]bool, len(occurs))
+  var chosen []int32
+  names := f.labelNames()
+  for len(chosen) < k {
+    var left []int
+    for _, v := range candidates {
+      if !removed[v] {
+        left = append(left, v)
+      }
+    }
+    if len(left) == 0 {
+      break
+    }
+    scores := make([]splitScore, len(left))
+    parallel(workers, func(w int) {
+      for i := w; i < len(left); i += workers {
+        s := splitWithout(f, occurs, removed, left[i], parents[w])
+        scores[i] = splitScore{s.largest, len(s.sizes)}
+      }
+    })
+    best := 0
+    for i := range scores {
+      if scores[best].worse(scores[i]) {
+        best = i
+      }
+    }
+    v := left[best]
+    removed[v] = true
+    chosen = append(chosen, int32(v))
+    logger.Printf("%s: separator %d: %s in %d clauses leaves %d components, the largest of %d clauses", path, len(chosen), litString(int32(v), names), len(occurs[v]), scores[best].components, scores[best].largest)
+  }
+  return chosen, splitWithout(f, occurs, removed, 0, parents[0])
+}
+
+// parseAssignment parses the literals of text, each of which must be of a variable in seps,
+// into a map from their variables to their values.
+func parseAssignment(text string, seps []int32) (map[int32]bool, error) {
+  isSep := map[int32]bool{}
+  for _, v := range seps {
+    isSep[v] = true
+  }
+  assign := map[int32]bool{}
+  for _, part := range strings.Fields(text) {
+    l, err := strconv.ParseInt(part, 10, 32)
+    if err != nil || l == 0 {
+      return nil, fmt.Errorf("invalid literal %q in -separator-assign", part)
+    }
+    v := varOf(int32(l))
+    if !isSep[v] {
+      return nil, fmt.Errorf("%d in -separator-assign is not a separator", v)
+    }
+    if val, ok := assign[v]; ok && val != (l > 0) {
+      return nil, fmt.Errorf("-separator-assign sets %d both ways", v)
+    }
+    assign[v] = l > 0
+  }
+  return assign, nil
+}
+
+// writeSplit writes the clauses of each component of s to a file in dir, largest first, along
+// with the clauses over separator variables alone, and a report of the components. The clauses
+// are simplified by the -separator-assign assignment, and written unchanged without one.
+func writeSplit(logger *log.Logger, dir, path string, f *formula, seps []int32, s *split) error {
+  assign, err := parseAssignment(*separatorAssign, seps)
+  if err != nil {
+    return err
+  }
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return err
+  }
+  members := make([][]int, len(s.sizes)+1)
+  for i, l := range s.label {
+    // clauses over the separators alone go last.
+    if l == -1 {
+      l = len(s.sizes)
+    }
+    members[l] = append(members[l], i)
+  }
+  order := make([]int, len(s.sizes))
+  for i := range order {
+    order[i] = i
+  }
+  sort.SliceStable(order, func(i, j int) bool { return s.sizes[order[i]] > s.sizes[order[j]] })
+  base := filepath.Base(path)
+  name := strings.TrimSuffix(base, filepath.Ext(base))
+  names := f.labelNames()
+  sepNames := make([]string, len(seps))
+  for i, v := range seps {
+    sepNames[i] = litString(v, names)
+  }
+  report, err := os.Create(filepath.Join(dir, name+".separators.txt"))
+  if err != nil {
+    return err
+  }
+  r := bufio.NewWriter(report)
+  fmt.Fprintf(r, "separators: %s\n", strings.Join(sepNames, " "))
+  if len(assign) > 0 {
+    fmt.Fprintf(r, "assignment: %s\n", *separatorAssign)
+  }
+  // write writes the clauses idxs to file, simplified by assign, and returns how many it wrote.
+  write := func(file string, idxs []int) (int, error) {
+    var clauses [][]int32
+    var groups, lines []int
+  next:
+    for _, i := range idxs {
+      c := f.clauses[i]
+      if len(assign) > 0 {
+        var kept []int32
+        for _, l := range c {
+          val, ok := assign[varOf(l)]
+          if !ok {
+            kept = append(kept, l)
+          } else if val == (l > 0) {
+            continue next
+          }
+        }
+        c = kept
+      }
+      clauses = append(clauses, c)
+      if f.gcnfGroups != nil {
+        groups = append(groups, f.gcnfGroups[i])
+      }
+      if *showLines {
+        lines = append(lines, f.lines[i])
+      }
+    }
+    out, err := os.Create(filepath.Join(dir, file))
+    if err != nil {
+      return 0, err
+    }
+    err = writeDimacs(out, clauses, groups, f.numGCNFGroups, lines)
+    if cerr := out.Close(); err == nil {
+      err = cerr
+    }
+    return len(clauses), err
+  }
+  for k, c := range order {
+    n, err := write(fmt.Sprintf("%s.part%d.cnf", name, k), members[c])
+    if err != nil {
+      report.Close()
+      return err
+    }
+    fmt.Fprintf(r, "part %d: %d clauses\n", k, n)
+  }
+  if rest := members[len(s.sizes)]; len(rest) > 0 {
+    n, err := write(name+".separators.cnf", rest)
+    if err != nil {
+      report.Close()
+      return err
+    }
+    fmt.Fprintf(r, "separators only: %d clauses\n", n)
+  }
+  err = r.Flush()
+  if cerr := report.Close(); err == nil {
+    err = cerr
+  }
+  if err == nil {
+    logger.Printf("%s: wrote %d parts to %s", path, len(s.sizes), dir)
+  }
+  return err
+}
+
+// factorEdgeAttrs returns the attributes of an edge between a clause and variable v, which is
+// dashed if the clause contains v negated.
+func factorEdgeAttrs(v int, neg bool) string {
+  var attrs []string
+  if *colorBy == "var" {
+    attrs = append(attrs, fmt.Sprintf("color=\"%s\"", palette[v%len(palette)]))
+  }
+  if neg {
+    attrs = append(attrs, "style=\"dashed\"")
+  }
+  if len(attrs) == 0 {
+    return ""
+  }
+  return " [ " + strings.Join(attrs, ", ") + " ]"
+}
+
+// factorGraph writes the factor graph of f to w, with clause nodes numbered as in the clause
+// graph and variable nodes named v<n>.
+func factorGraph(w io.Writer, f *formula) error {
+  s := bufio.NewWriter(w)
+  s.WriteString("graph {\n")
+  s.WriteString("  overlap = false;\n")
+  s.WriteString("  node [ shape = box ];\n")
+  if *clusterComments || f.gcnfGroups != nil {
+    writeClusters(s, f)
+  } else {
+    for i := range f.clauses {
+      fmt.Fprintf(s, "  %d [ %s ]\n", i, nodeAttrs(f, i))
+    }
+  }
+  names := f.labelNames()
+  seen := map[int32]bool{}
+  var vars []int32
+  for _, c := range f.clauses {
+    for _, l := range c {
+      if v := varOf(l); !seen[v] {
+        seen[v] = true
+        vars = append(vars, v)
+      }
+    }
+  }
+  if *canonical {
+    sort.Slice(vars, func(i, j int) bool { return vars[i] < vars[j] })
+  }
+  for _, v := range vars {
+    label := strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(litString(v, names))
+    attrs := fmt.Sprintf("label = \"%s\", shape = circle", label)
+    if f.varCentrality != nil {
+      attrs += fmt.Sprintf(", centrality = \"%.6g\"", f.varCentrality[v])
+    }
+    fmt.Fprintf(s, "  v%d [ %s ]\n", v, attrs)
+  }
+  for i, c := range f.clauses {
+    for _, l := range c {
+      fmt.Fprintf(s, "  %d -- v%d%s\n", i, varOf(l), factorEdgeAttrs(int(varOf(l)), l < 0))
+    }
+  }
+  if *legend {
+    s.WriteString("  subgraph cluster_legend {\n")
+    s.WriteString("    label = \"legend\";\n")
+    s.WriteString("    node [ shape = plaintext ];\n")
+    s.WriteString("    legend_pos_a [ label = \"positive occurrence\" ]\n")
+    s.WriteString("    legend_pos_b [ label = \"\" ]\n")
+    fmt.Fprintf(s, "    legend_pos_a -- legend_pos_b%s\n", factorEdgeAttrs(0, false))
+    s.WriteString("    legend_neg_a [ label = \"negative occurrence\" ]\n")
+    s.WriteString("    legend_neg_b [ label = \"\" ]\n")
+    fmt.Fprintf(s, "    legend_neg_a -- legend_neg_b%s\n", factorEdgeAttrs(0, true))
+    if *classifyClauses {
+      for c := tautological; c <= unitImplied; c++ {
+        fmt.Fprintf(s, "    legend_class_%d [ label = \"%s\", shape = box%s ]\n", c, classNames[c], classAttrs[c])
+      }
+    }
+    s.WriteString("  }\n")
+  }
+  s.WriteString("}\n")
+  return s.Flush()
+}
+
+// heatColor returns the color a fraction t in [0, 1] of the way along the heatmap gradient,
+// from blue through yellow to red.
+func heatColor(t float64) string {
+  t = math.Max(0, math.Min(1, t))
+  var r, g, b float64
+  if t < 0.5 {
+    r, g, b = 2*t, 2*t, 1-2*t
+  } else {
+    r, g, b = 1, 2-2*t, 0
+  }
+  return fmt.Sprintf("#%02x%02x%02x", int(255*r), int(255*g), int(255*b))
+}
+
+// heat returns where n falls on a logarithmic scale from 0 to most, as occurrence counts are
+// usually heavily skewed.
+func heat(n, most int) float64 {
+  if most <= 0 {
+    return 0
+  }
+  return math.Log1p(float64(n)) / math.Log1p(float64(most))
+}
+
+// varGraph writes the graph joining variables which share a clause to w, with variable nodes
+// named v<n> as in the factor graph. With -heatmap each node is filled by its number of
+// occurrences and sized by its degree, and the -legend shows the color scale.
+func varGraph(w io.Writer, f *formula) error {
+  adj := variableGraph(f)
+  occurs := make([]int, len(adj)+1)
+  for _, c := range f.clauses {
+    for _, l := range c {
+      occurs[varOf(l)]++
+    }
+  }
+  mostOccurs, mostDegree := 0, 0
+  for v, ns := range adj {
+    mostOccurs = max(mostOccurs, occurs[v+1])
+    mostDegree = max(mostDegree, len(ns))
+  }
+  s := bufio.NewWriter(w)
+  s.WriteString("graph {\n")
+  s.WriteString("  overlap = false;\n")
+  s.WriteString("  node [ shape = circle ];\n")
+  names := f.labelNames()
+  escape := strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
+  for i, ns := range adj {
+    v := i + 1
+    if occurs[v] == 0 {
+      continue
+    }
+    attrs := fmt.Sprintf("label = \"%s\", occurrences = \"%d\", degree = \"%d\"",
+      escape.Replace(litString(int32(v), names)), occurs[v], len(ns))
+    if *heatmap {
+      width := 0.4
+      if mostDegree > 0 {
+        width += 1.2 * math.Sqrt(float64(len(ns))/float64(mostDegree))
+      }
+      attrs += fmt.Sprintf(", style = filled, fillcolor = \"%s\", width = \"%.2f\", fixedsize = true",
+        heatColor(heat(occurs[v], mostOccurs)), width)
+    }
+    if f.varCentrality != nil {
+      attrs += fmt.Sprintf(", centrality = \"%.6g\"", f.varCentrality[v])
+    }
+    fmt.Fprintf(s, "  v%d [ %s ]\n", v, attrs)
+  }
+  for i, ns := range adj {
+    for _, j := range ns {
+      if j > i {
+        fmt.Fprintf(s, "  v%d -- v%d\n", i+1, j+1)
+      }
+    }
+  }
+  if *legend {
+    s.WriteString("  subgraph cluster_legend {\n")
+    s.WriteString("    label = \"legend\";\n")
+    s.WriteString("    node [ shape = plaintext ];\n")
+    s.WriteString("    legend_edge_a [ label = \"variables sharing a clause\" ]\n")
+    s.WriteString("    legend_edge_b [ label = \"\" ]\n")
+    s.WriteString("    legend_edge_a -- legend_edge_b\n")
+    if *heatmap {
+      s.WriteString("    legend_size [ label = \"node size = degree\" ]\n")
+      // swatches at evenly spaced points of the scale, labeled with the count there.
+      const swatches = 5
+      for k := 0; k < swatches; k++ {
+        t := float64(k) / (swatches - 1)
+        n := int(math.Round(math.Expm1(t * math.Log1p(float64(mostOccurs)))))
+        fmt.Fprintf(s, "    legend_heat_%d [ label = \"%d occurrences\", shape = box, style = filled, fillcolor = \"%s\" ]\n",
+          k, n, heatColor(t))
+        if k > 0 {
+          fmt.Fprintf(s, "    legend_heat_%d -- legend_heat_%d [ style = invis ]\n", k-1, k)
+        }
+      }
+    }
+    s.WriteString("  }\n")
+  }
+  s.WriteString("}\n")
+  return s.Flush()
+}
+
+// definition is a variable defined by a gate over input literals: kind is and, or, equiv (of
+// a single input), xor or xnor.
+type definition struct {
+  out int32
+  kind string
+  inputs []int32
+}
+
+// definitions finds the variables defined by their Tseitin clauses. An and gate v = a & b is
+// found from a clause (v, -a, -b) whose other literals each form a binary clause with -v, and
+// an or gate likewise from the negated output, so both are found whatever the encoder's
+// polarity. Equivalences are the binary case, defining the larger variable. A xor of two inputs
+// is found from the four ternary clauses over three variables forbidding the assignments of
+// one parity, and defines the largest of them. A variable keeps the first definition found in
+// clause order, and a definition which would make a variable depend on itself is skipped, so the
+// definitions form a DAG. They are sorted by output.
+func definitions(clauses [][]int32) []definition {
+  binary := map[[2]int32]bool{}
+  // patterns maps the variables of ternary clauses to the sets of negated positions among them.
+  patterns := map[[3]int32]map[int]bool{}
+  for _, c := range clauses {
+    switch len(c) {
+    case 2:
+      binary[[2]int32{min(c[0], c[1]), max(c[0], c[1])}] = true
+    case 3:
+      lits := []int32{c[0], c[1], c[2]}
+      sort.Slice(lits, func(i, j int) bool { return varOf(lits[i]) < varOf(lits[j]) })
+      key := [3]int32{varOf(lits[0]), varOf(lits[1]), varOf(lits[2])}
+      if key[0] == key[1] || key[1] == key[2] {
+        continue
+      }
+      mask := 0
+      for i, l := range lits {
+        if l < 0 {
+          mask |= 1 << i
+        }
+      }
+      if patterns[key] == nil {
+        patterns[key] = map[int]bool{}
+      }
+      patterns[key][mask] = true
+    }
+  }
+  defs := map[int32]*definition{}
+  // stamp marks the variables visited by the current search for a cycle.
+  stamp := map[int32]int{}
+  search := 0
+  var reaches func(v, target int32) bool
+  reaches = func(v, target int32) bool {
+    if v == target {
+      return true
+    }
+    if stamp[v] == search {
+      return false
+    }
+    stamp[v] = search
+    if d := defs[v]; d != nil {
+      for _, in := range d.inputs {
+        if reaches(varOf(in), target) {
+          return true
+        }
+      }
+    }
+    return false
+  }
+  add := func(d *definition) {
+    if defs[d.out] != nil {
+      return
+    }
+    search++
+    for _, in := range d.inputs {
+      if reaches(varOf(in), d.out) {
+        return
+      }
+    }
+    defs[d.out] = d
+  }
+  for _, c := range clauses {
+    if len(c) < 2 {
+      continue
+    }
+  outputs:
+    for _, g := range c {
+      var inputs []int32
+      for _, m := range c {
+        if m == g {
+          continue
+        }
+        if !binary[[2]int32{min(-g, -m), max(-g, -m)}] {
+          continue outputs
+        }
+        if g > 0 {
+          inputs = append(inputs, -m)
+        } else {
+          inputs = append(inputs, m)
+        }
+      }
+      kind := "and"
+      if g < 0 {
+        kind = "or"
+      }
+      if len(inputs) == 1 {
+        if varOf(inputs[0]) > varOf(g) {
+          continue
+        }
+        kind = "equiv"
+      }
+      add(&definition{varOf(g), kind, inputs})
+    }
+  }
+  keys := make([][3]int32, 0, len(patterns))
+  for k := range patterns {
+    keys = append(keys, k)
+  }
+  sort.Slice(keys, func(i, j int) bool {
+    for k := range keys[i] {
+      if keys[i][k] != keys[j][k] {
+        return keys[i][k] < keys[j][k]
+      }
+    }
+    return false
+  })
+  for _, k := range keys {
+    for _, parity := range []int{0, 1} {
+      n := 0
+      for mask := range patterns[k] {
+        if bits.OnesCount(uint(mask))%2 == parity {
+          n++
+        }
+      }
+      if n < 4 {
+        continue
+      }
+      // the clauses forbid the assignments of this parity, so the xor of all three is the other.
+      kind := "xor"
+      if parity == 0 {
+        kind = "xnor"
+      }
+      add(&definition{k[2], kind, []int32{k[0], k[1]}})
+    }
+  }
+  out := make([]definition, 0, len(defs))
+  for _, d := range defs {
+    out = append(out, *d)
+  }
+  sort.Slice(out, func(i, j int) bool { return out[i].out < out[j].out })
+  return out
+}
+
+// definitionGraph writes the DAG of the definitions of f to w, with an edge from each input to
+// the variable it defines, dashed for negated inputs. Defined variables are boxes labeled with
+// their gate, and the inputs which are not defined are ellipses.
+func definitionGraph(logger *log.Logger, w io.Writer, path string, f *formula) error {
+  defs := definitions(f.clauses)
+  names := f.labelNames()
+  defined := map[int32]string{}
+  var vars []int32
+  seen := map[int32]bool{}
+  counts := map[string]int{}
+  for _, d := range defs {
+    defined[d.out] = d.kind
+    counts[d.kind]++
+    for _, v := range append([]int32{d.out}, d.inputs...) {
+      if v = varOf(v); !seen[v] {
+        seen[v] = true
+        vars = append(vars, v)
+      }
+    }
+  }
+  sort.Slice(vars, func(i, j int) bool { return vars[i] < vars[j] })
+  inputs := len(vars) - len(defs)
+  kinds := make([]string, 0, len(counts))
+  for k, n := range counts {
+    kinds = append(kinds, fmt.Sprintf("%d %s", n, k))
+  }
+  sort.Strings(kinds)
+  logger.Printf("%s: %d definitions (%s) over %d inputs", path, len(defs), strings.Join(kinds, ", "), inputs)
+
+  s := bufio.NewWriter(w)
+  s.WriteString("digraph {\n")
+  escape := strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
+  for _, v := range vars {
+    label := escape.Replace(litString(v, names))
+    if kind, ok := defined[v]; ok {
+      fmt.Fprintf(s, "  x%d [ label = \"%s\\n%s\", shape = box ]\n", v, label, kind)
+    } else {
+      fmt.Fprintf(s, "  x%d [ label = \"%s\" ]\n", v, label)
+    }
+  }
+  for _, d := range defs {
+    for _, in := range d.inputs {
+      style := ""
+      if in < 0 {
+        style = " [ style=\"dashed\" ]"
+      }
+      fmt.Fprintf(s, "  x%d -> x%d%s\n", varOf(in), d.out, style)
+    }
+  }
+  if *legend {
+    s.WriteString("  subgraph cluster_legend {\n")
+    s.WriteString("    label = \"legend\";\n")
+    s.WriteString("    node [ shape = plaintext ];\n")
+    s.WriteString("    legend_defined [ label = \"defined variable\\nand its gate\", shape = box ]\n")
+    s.WriteString("    legend_input [ label = \"undefined input\", shape = ellipse ]\n")
+    s.WriteString("    legend_neg_a [ label = \"negated input\" ]\n")
+    s.WriteString("    legend_neg_b [ label = \"\" ]\n")
+    s.WriteString("    legend_neg_a -> legend_neg_b [ style=\"dashed\" ]\n")
+    s.WriteString("  }\n")
+  }
+  s.WriteString("}\n")
+  return s.Flush()
+}
+
+// edgeList writes the edges of the clause graph (or the factor graph) as a tab separated table.
+// Unlike forEachEdge, every shared variable is counted, so the weight of a row is the number of
+// variables its clauses share with that polarity.
+func edgeList(w io.Writer, f *formula) error {
+  s := bufio.NewWriter(w)
+  s.WriteString("src\tdst\tpolarity\tweight\n")
+  if *mode == "factor" {
+    for i, c := range f.clauses {
+      for _, l := range c {
+        polarity := "pos"
+        if l < 0 {
+          polarity = "neg"
+        }
+        fmt.Fprintf(s, "%d\tv%d\t%s\t1\n", i, varOf(l), polarity)
+      }
+    }
+    return s.Flush()
+  }
+  occurs := occurrences(f.clauses)
+  // count[k][b] is the number of variables clause b shares with the current clause with
+  // polarity kind k, and touched the clauses with a nonzero count.
+  var count [2][]int
+  count[0] = make([]int, len(f.clauses))
+  count[1] = make([]int, len(f.clauses))
+  var touched []int
+  for a, clause := range f.clauses {
+    for _, l := range clause {
+      occs := occurs.of(l)
+      start := sort.Search(len(occs), func(i int) bool { return occs[i].Clause > a })
+      for _, b := range occs[start:] {
+        if count[0][b.Clause] == 0 && count[1][b.Clause] == 0 {
+          touched = append(touched, b.Clause)
+        }
+        if b.Matches(l) {
+          count[1][b.Clause]++
+        } else {
+          count[0][b.Clause]++
+        }
+      }
+    }
+    sort.Ints(touched)
+    for _, b := range touched {
+      if n := count[1][b]; n > 0 {
+        fmt.Fprintf(s, "%d\t%d\tsame\t%d\n", a, b, n)
+      }
+      if n := count[0][b]; n > 0 {
+        fmt.Fprintf(s, "%d\t%d\tdiff\t%d\n", a, b, n)
+      }
+      count[0][b], count[1][b] = 0, 0
+    }
+    touched = touched[:0]
+  }
+  return s.Flush()
+}
+
+// layout places n nodes using the Fruchterman-Reingold force directed algorithm, returning
+// coordinates in the unit square. The result is deterministic for a given graph.
+func layout(n int, edges []edge) [][2]float64 {
+  rng := rand.New(rand.NewSource(1))
+  pos := make([][2]float64, n)
+  for i := range pos {
+    pos[i] = [2]float64{rng.Float64(), rng.Float64()}
+  }
+  if n < 2 {
+    return pos
+  }
+  k := math.Sqrt(1 / float64(n))
+  disp := make([][2]float64, n)
+  const iterations = 200
+  gravity := 10 * k
+  for it := 0; it < iterations; it++ {
+    temp := 0.1 * (1 - float64(it)/iterations)
+    for i := range disp {
+      disp[i] = [2]float64{}
+    }
+    for i := 0; i < n; i++ {
+      for j := i + 1; j < n; j++ {
+        dx, dy := pos[i][0]-pos[j][0], pos[i][1]-pos[j][1]
+        d := math.Max(math.Hypot(dx, dy), 1e-6)
+        force := k * k / d
+        disp[i][0] += dx / d * force
+        disp[i][1] += dy / d * force
+        disp[j][0] -= dx / d * force
+        disp[j][1] -= dy / d * force
+      }
+    }
+    for _, e := range edges {
+      dx, dy := pos[e.a][0]-pos[e.b][0], pos[e.a][1]-pos[e.b][1]
+      d := math.Max(math.Hypot(dx, dy), 1e-6)
+      force := d * d / k
+      disp[e.a][0] -= dx / d * force
+      disp[e.a][1] -= dy / d * force
+      disp[e.b][0] += dx / d * force
+      disp[e.b][1] += dy / d * force
+    }
+    for i := range pos {
+      // pull towards the center so disconnected pieces aren't pushed into the border.
+      disp[i][0] -= (pos[i][0] - 0.5) * gravity
+      disp[i][1] -= (pos[i][1] - 0.5) * gravity
+      d := math.Max(math.Hypot(disp[i][0], disp[i][1]), 1e-6)
+      step := math.Min(d, temp)
+      pos[i][0] = math.Min(1, math.Max(0, pos[i][0]+disp[i][0]/d*step))
+      pos[i][1] = math.Min(1, math.Max(0, pos[i][1]+disp[i][1]/d*step))
+    }
+  }
+  return pos
+}
+
+const renderSize = 1000
+const renderMargin = 20
+
+func toPixels(p [2]float64) (int, int) {
+  span := float64(renderSize - 2*renderMargin)
+  return renderMargin + int(p[0]*span), renderMargin + int(p[1]*span)
+}
+
+// renderFile lays out the clause graph and draws it to path, as an svg or png depending on the
+// extension.
+func renderFile(path string, f *formula, edges []edge) error {
+  pos := layout(len(f.clauses), edges)
+  out, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  switch strings.ToLower(filepath.Ext(path)) {
+  case ".svg":
+    err = writeSVG(out, f, pos, edges)
+  case ".png":
+    err = writePNG(out, pos, edges)
+  default:
+    err = fmt.Errorf("cannot render to %s, expected a .svg or .png file", path)
+  }
+  if cerr := out.Close(); err == nil {
+    err = cerr
+  }
+  return err
+}
+
+func writeSVG(w io.Writer, f *formula, pos [][2]float64, edges []edge) error {
+  b := bufio.NewWriter(w)
+  fmt.Fprintf(b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">\n", renderSize, renderSize)
+  b.WriteString("<rect width=\"100%\" height=\"100%\" fill=\"white\"/>\n")
+  for _, e := range edges {
+    color, dashed := edgeStyle(e.v, e.same)
+    if color == "" {
+      color = "black"
+    }
+    x1, y1 := toPixels(pos[e.a])
+    x2, y2 := toPixels(pos[e.b])
+    dash := ""
+    if dashed {
+      dash = " stroke-dasharray=\"4,3\""
+    }
+    line := fmt.Sprintf("<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\"%s/>", x1, y1, x2, y2, color, dash)
+    if *edgeLabels != "none" {
+      line = fmt.Sprintf("<g><title>%s</title>%s</g>", html.EscapeString(edgeDescription(f, e)), line)
+    }
+    b.WriteString(line + "\n")
+  }
+  for i, p := range pos {
+    x, y := toPixels(p)
+    title := fmt.Sprintf("%d %s", i, clauseString(f.clauses[i], f.labelNames()))
+    if *showLines {
+      title += fmt.Sprintf(" (line %d)", f.lines[i])
+    }
+    fmt.Fprintf(b, "<g><title>%s</title>", html.EscapeString(title))
+    fmt.Fprintf(b, "<circle cx=\"%d\" cy=\"%d\" r=\"5\" fill=\"lightgray\" stroke=\"black\"/>", x, y)
+    fmt.Fprintf(b, "<text x=\"%d\" y=\"%d\" font-size=\"10\">%d</text></g>\n", x+6, y-6, i)
+  }
+  b.WriteString("</svg>\n")
+  return b.Flush()
+}
+
+// rgb of the colors which are likely to be used for edges, others are drawn black.
+var rgb = map[string]color.RGBA{
+  "red": {255, 0, 0, 255}, "blue": {0, 0, 255, 255}, "darkgreen": {0, 100, 0, 255},
+  "orange": {255, 165, 0, 255}, "purple": {128, 0, 128, 255}, "brown": {165, 42, 42, 255},
+  "magenta": {255, 0, 255, 255}, "darkcyan": {0, 139, 139, 255}, "goldenrod": {218, 165, 32, 255},
+  "navy": {0, 0, 128, 255}, "olivedrab": {107, 142, 35, 255}, "deeppink": {255, 20, 147, 255},
+  "sienna": {160, 82, 45, 255}, "steelblue": {70, 130, 180, 255}, "darkviolet": {148, 0, 211, 255},
+  "dimgray": {105, 105, 105, 255}, "black": {0, 0, 0, 255}, "gray": {128, 128, 128, 255},
+  "green": {0, 128, 0, 255},
+}
+
+func parseColor(name string) color.RGBA {
+  if c, ok := rgb[strings.ToLower(name)]; ok {
+    return c
+  }
+  var r, g, b uint8
+  if _, err := fmt.Sscanf(name, "#%02x%02x%02x", &r, &g, &b); err == nil {
+    return color.RGBA{r, g, b, 255}
+  }
+  return rgb["black"]
+}
+
+func writePNG(w io.Writer, pos [][2]float64, edges []edge) error {
+  img := image.NewRGBA(image.Rect(0, 0, renderSize, renderSize))
+  draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+  for _, e := range edges {
+    name, dashed := edgeStyle(e.v, e.same)
+    c := parseColor(name)
+    x1, y1 := toPixels(pos[e.a])
+    x2, y2 := toPixels(pos[e.b])
+    // bresenham, skipping every other run of pixels for dashed edges.
+    dx, dy := abs(x2-x1), -abs(y2-y1)
+    sx, sy := sign(x2-x1), sign(y2-y1)
+    err := dx + dy
+    for step := 0; ; step++ {
+      if !dashed || (step/4)%2 == 0 {
+        img.SetRGBA(x1, y1, c)
+      }
+      if x1 == x2 && y1 == y2 {
+        break
+      }
+      e2 := 2 * err
+      if e2 >= dy {
+        err += dy
+        x1 += sx
+      }
+      if e2 <= dx {
+        err += dx
+        y1 += sy
+      }
+    }
+  }
+  for _, p := range pos {
+    x, y := toPixels(p)
+    for i := -4; i <= 4; i++ {
+      for j := -4; j <= 4; j++ {
+        if i*i+j*j <= 16 {
+          img.SetRGBA(x+i, y+j, rgb["black"])
+        }
+      }
+    }
+  }
+  return png.Encode(w, img)
+}
+
+// stats summarizes a distribution of values, as in SATzilla's features.
+type stats struct {
+  Mean float64 `json:"mean"`
+  // Variation is the coefficient of variation, the standard deviation over the mean.
+  Variation float64 `json:"variation"`
+  Min float64 `json:"min"`
+  Max float64 `json:"max"`
+  // Entropy is the Shannon entropy in bits of the histogram of values.
+  Entropy float64 `json:"entropy"`
+}
+
+func summarize(values []float64) stats {
+  if len(values) == 0 {
+    return stats{}
+  }
+  s := stats{Min: values[0], Max: values[0]}
+  counts := map[float64]int{}
+  for _, v := range values {
+    s.Mean += v
+    s.Min = math.Min(s.Min, v)
+    s.Max = math.Max(s.Max, v)
+    counts[v]++
+  }
+  n := float64(len(values))
+  s.Mean /= n
+  variance := 0.0
+  for _, v := range values {
+    variance += (v - s.Mean) * (v - s.Mean)
+  }
+  if s.Mean != 0 {
+    s.Variation = math.Sqrt(variance/n) / math.Abs(s.Mean)
+  }
+  for _, c := range counts {
+    p := float64(c) / n
+    s.Entropy -= p * math.Log2(p)
+  }
+  return s
+}
+
+// instanceFeatures are the features written by -features.
+type instanceFeatures struct {
+  File string `json:"file"`
+  Vars int `json:"vars"`
+  Clauses int `json:"clauses"`
+  ClausesPerVar float64 `json:"clauses_per_var"`
+  // fractions of clauses by length, and of Horn clauses with at most one positive literal.
+  Unit float64 `json:"unit"`
+  Binary float64 `json:"binary"`
+  Ternary float64 `json:"ternary"`
+  Horn float64 `json:"horn"`
+  ClauseLength stats `json:"clause_length"`
+  // VarDegree is the number of clauses each variable occurs in, the degree in the
+  // variable-clause graph.
+  VarDegree stats `json:"var_degree"`
+  // VarGraphDegree is the number of other variables each variable shares a clause with.
+  VarGraphDegree stats `json:"var_graph_degree"`
+  // ClauseGraphDegree is the degree of each clause in the graph clause_graph draws.
+  ClauseGraphDegree stats `json:"clause_graph_degree"`
+  // ClauseBalance is the fraction of positive literals per clause, and VarBalance the fraction
+  // of positive occurrences per variable.
+  ClauseBalance stats `json:"clause_balance"`
+  VarBalance stats `json:"var_balance"`
+  HornVarDegree stats `json:"horn_var_degree"`
+}
+
+// writeFeatures writes the features of f as JSON.
+func writeFeatures(logger *log.Logger, w io.Writer, path string, f *formula) error {
+  ft := instanceFeatures{File: path, Clauses: len(f.clauses)}
+  var maxVar int32
+  for _, c := range f.clauses {
+    for _, l := range c {
+      maxVar = max(maxVar, varOf(l))
+    }
+  }
+  pos := make([]int, maxVar+1)
+  neg := make([]int, maxVar+1)
+  horn := make([]int, maxVar+1)
+  var lengths, balance []float64
+  hornClauses := 0
+  for _, c := range f.clauses {
+    positive := 0
+    for _, l := range c {
+      if l > 0 {
+        positive++
+        pos[l]++
+      } else {
+        neg[-l]++
+      }
+    }
+    switch len(c) {
+    case 1:
+      ft.Unit++
+    case 2:
+      ft.Binary++
+    case 3:
+      ft.Ternary++
+    }
+    if positive <= 1 {
+      hornClauses++
+      for _, l := range c {
+        horn[varOf(l)]++
+      }
+    }
+    lengths = append(lengths, float64(len(c)))
+    if len(c) > 0 {
+      balance = append(balance, float64(positive)/float64(len(c)))
+    }
+  }
+  ft.Horn = float64(hornClauses)
+  // stamp[u] is v once u has been counted as a neighbour of v in the variable graph.
+  occurs := occurrences(f.clauses)
+  stamp := make([]int32, maxVar+1)
+  var degrees, varBalance, hornDegrees, varGraph []float64
+  for v := int32(1); v <= maxVar; v++ {
+    n := pos[v] + neg[v]
+    if n == 0 {
+      continue
+    }
+    ft.Vars++
+    degrees = append(degrees, float64(n))
+    varBalance = append(varBalance, float64(pos[v])/float64(n))
+    hornDegrees = append(hornDegrees, float64(horn[v]))
+    stamp[v] = v
+    neighbours := 0
+    for _, lit := range [2]int32{v, -v} {
+      for _, o := range occurs.of(lit) {
+        for _, l := range f.clauses[o.Clause] {
+          if u := varOf(l); stamp[u] != v {
+            stamp[u] = v
+            neighbours++
+          }
+        }
+      }
+    }
+    varGraph = append(varGraph, float64(neighbours))
+  }
+  cg := make([]float64, len(f.clauses))
+  forEachEdge(logger, f, func(e edge) {
+    cg[e.a]++
+    cg[e.b]++
+  })
+  if ft.Vars > 0 {
+    ft.ClausesPerVar = float64(ft.Clauses) / float64(ft.Vars)
+  }
+  if ft.Clauses > 0 {
+    n := float64(ft.Clauses)
+    ft.Unit /= n
+    ft.Binary /= n
+    ft.Ternary /= n
+    ft.Horn /= n
+  }
+  ft.ClauseLength = summarize(lengths)
+  ft.VarDegree = summarize(degrees)
+  ft.VarGraphDegree = summarize(varGraph)
+  ft.ClauseGraphDegree = summarize(cg)
+  ft.ClauseBalance = summarize(balance)
+  ft.VarBalance = summarize(varBalance)
+  ft.HornVarDegree = summarize(hornDegrees)
+  enc := json.NewEncoder(w)
+  enc.SetIndent("", "  ")
+  return enc.Encode(ft)
+}
+
+// ksDistance is the Kolmogorov-Smirnov statistic of two samples, the largest difference between
+// their empirical distribution functions.
+func ksDistance(a, b []float64) float64 {
+  if len(a) == 0 || len(b) == 0 {
+    if len(a) == len(b) {
+      return 0
+    }
+    return 1
+  }
+  sort.Float64s(a)
+  sort.Float64s(b)
+  d := 0.0
+  i, j := 0, 0
+  for i < len(a) && j < len(b) {
+    x := math.Min(a[i], b[j])
+    for i < len(a) && a[i] == x {
+      i++
+    }
+    for j < len(b) && b[j] == x {
+      j++
+    }
+    d = math.Max(d, math.Abs(float64(i)/float64(len(a))-float64(j)/float64(len(b))))
+  }
+  return d
+}
+
+// spectrum estimates the k largest eigenvalues of the normalized adjacency matrix
+// D^-1/2 A D^-1/2 of the graph adj by subspace iteration. Its eigenvalues lie in [-1, 1], so
+// iterating (I + M) / 2 instead, which is positive semidefinite, finds the largest ones rather
+// than those of largest magnitude.
+func spectrum(adj [][]int, k int) []float64 {
+  n := len(adj)
+  k = min(k, n)
+  scale := make([]float64, n)
+  for i, ns := range adj {
+    if len(ns) > 0 {
+      scale[i] = 1 / math.Sqrt(float64(len(ns)))
+    }
+  }
+  apply := func(x, y []float64) {
+    for i, ns := range adj {
+      sum := 0.0
+      for _, j := range ns {
+        sum += scale[j] * x[j]
+      }
+      y[i] = (x[i] + scale[i]*sum) / 2
+    }
+  }
+  rng := rand.New(rand.NewSource(1))
+  vecs := make([][]float64, k)
+  for i := range vecs {
+    vecs[i] = make([]float64, n)
+    for j := range vecs[i] {
+      vecs[i][j] = rng.Float64() - 0.5
+    }
+  }
+  // orthonormalize makes vecs orthonormal by Gram-Schmidt.
+  orthonormalize := func() {
+    for i, v := range vecs {
+      for _, u := range vecs[:i] {
+        dot := 0.0
+        for j := range v {
+          dot += v[j] * u[j]
+        }
+        for j := range v {
+          v[j] -= dot * u[j]
+        }
+      }
+      norm := 0.0
+      for _, x := range v {
+        norm += x * x
+      }
+      if norm = math.Sqrt(norm); norm > 0 {
+        for j := range v {
+          v[j] /= norm
+        }
+      }
+    }
+  }
+  orthonormalize()
+  tmp := make([]float64, n)
+  for iter := 0; iter < 300; iter++ {
+    for _, v := range vecs {
+      apply(v, tmp)
+      copy(v, tmp)
+    }
+    orthonormalize()
+  }
+  values := make([]float64, k)
+  for i, v := range vecs {
+    apply(v, tmp)
+    q := 0.0
+    for j := range v {
+      q += v[j] * tmp[j]
+    }
+    values[i] = 2*q - 1
+  }
+  sort.Sort(sort.Reverse(sort.Float64Slice(values)))
+  return values
+}
+
+// comparison is the output of -compare.
+type comparison struct {
+  A string `json:"a"`
+  B string `json:"b"`
+  ClauseDegreeKS float64 `json:"clause_degree_ks"`
+  VarDegreeKS float64 `json:"var_degree_ks"`
+  SpectrumA []float64 `json:"spectrum_a"`
+  SpectrumB []float64 `json:"spectrum_b"`
+  SpectralDistance float64 `json:"spectral_distance"`
+}
+
+// graphSummary returns the clause graph's adjacency lists and the number of occurrences of each
+// variable.
+func graphSummary(logger *log.Logger, f *formula) ([][]int, []float64) {
+  adj := make([][]int, len(f.clauses))
+  forEachEdge(logger, f, func(e edge) {
+    adj[e.a] = append(adj[e.a], e.b)
+    adj[e.b] = append(adj[e.b], e.a)
+  })
+  var degrees []float64
+  for _, occs := range occurrences(f.clauses) {
+    if len(occs) > 0 {
+      degrees = append(degrees, float64(len(occs)))
+    }
+  }
+  return adj, degrees
+}
+
+// compare writes the similarity metrics of the clause graphs of a and b as JSON.
+func compare(logger *log.Logger, w io.Writer, pathA string, a *formula, pathB string, b *formula) error {
+  adjA, varsA := graphSummary(logger, a)
+  adjB, varsB := graphSummary(logger, b)
+  degrees := func(adj [][]int) []float64 {
+    out := make([]float64, len(adj))
+    for i, ns := range adj {
+      out[i] = float64(len(ns))
+    }
+    return out
+  }
+  c := comparison{
+    A: pathA,
+    B: pathB,
+    ClauseDegreeKS: ksDistance(degrees(adjA), degrees(adjB)),
+    VarDegreeKS: ksDistance(varsA, varsB),
+    SpectrumA: spectrum(adjA, *spectrumSize),
+    SpectrumB: spectrum(adjB, *spectrumSize),
+  }
+  for i := 0; i < max(len(c.SpectrumA), len(c.SpectrumB)); i++ {
+    var x, y float64
+    if i < len(c.SpectrumA) {
+      x = c.SpectrumA[i]
+    }
+    if i < len(c.SpectrumB) {
+      y = c.SpectrumB[i]
+    }
+    c.SpectralDistance += (x - y) * (x - y)
+  }
+  c.SpectralDistance = math.Sqrt(c.SpectralDistance)
+  enc := json.NewEncoder(w)
+  enc.SetIndent("", "  ")
+  return enc.Encode(c)
+}
+
+// inputs expands the -f arguments, replacing directories by the cnf files inside them.
+func inputs() ([]string, error) {
+  var out []string
+  for _, p := range filePaths {
+    info, err := os.Stat(p)
+    if err != nil {
+      return nil, err
+    }
+    if !info.IsDir() {
+      out = append(out, p)
+      continue
+    }
+    matches, err := filepath.Glob(filepath.Join(p, "*.cnf"))
+    if err != nil {
+      return nil, err
+    }
+    sort.Strings(matches)
+    out = append(out, matches...)
+  }
+  return out, nil
+}
+
+// outputPath fills in the -name template for the input file at path.
+func outputPath(path string) string {
+  base := filepath.Base(path)
+  name := strings.TrimSuffix(base, filepath.Ext(base))
+  r := strings.NewReplacer("{name}", name, "{base}", base)
+  return filepath.Join(*outDir, r.Replace(*nameTemplate))
+}
+
+// denoise drops the clauses selected by -drop-units, -drop-pure and -drop-duplicates from f,
+// logging how many of each were dropped.
+func denoise(logger *log.Logger, path string, f *formula) {
+  if !*dropUnits && !*dropPure && !*dropDuplicates {
+    return
+  }
+  polarity := map[int32]int{}
+  for _, c := range f.clauses {
+    for _, l := range c {
+      if l > 0 {
+        polarity[l] |= 1
+      } else {
+        polarity[-l] |= 2
+      }
+    }
+  }
+  seen := map[string]bool{}
+  var units, pure, duplicates int
+  keep := make([]bool, len(f.clauses))
+  for i, c := range f.clauses {
+    if *dropUnits && len(c) == 1 {
+      units++
+      continue
+    }
+    if *dropPure {
+      hasPure := false
+      for _, l := range c {
+        hasPure = hasPure || polarity[varOf(l)] != 3
+      }
+      if hasPure {
+        pure++
+        continue
+      }
+    }
+    if *dropDuplicates {
+      sorted := append([]int32{}, c...)
+      sortLits(sorted)
+      key := fmt.Sprint(sorted)
+      if seen[key] {
+        duplicates++
+        continue
+      }
+      seen[key] = true
+    }
+    keep[i] = true
+  }
+  n := keepClauses(f, keep)
+  logger.Printf("%s: dropped %d unit, %d pure and %d duplicate clauses, %d remain", path, units, pure, duplicates, n)
+}
+
+// keepClauses removes the clauses of f for which keep is false, and returns how many remain.
+func keepClauses(f *formula, keep []bool) int {
+  n := 0
+  for i := range f.clauses {
+    if !keep[i] {
+      continue
+    }
+    f.clauses[n] = f.clauses[i]
+    f.groups[n] = f.groups[i]
+    f.lines[n] = f.lines[i]
+    if f.gcnfGroups != nil {
+      f.gcnfGroups[n] = f.gcnfGroups[i]
+    }
+    n++
+  }
+  f.clauses, f.groups, f.lines = f.clauses[:n], f.groups[:n], f.lines[:n]
+  if f.gcnfGroups != nil {
+    f.gcnfGroups = f.gcnfGroups[:n]
+  }
+  return n
+}
+
+// filterNode is a node of a -filter expression. Every value is an integer, with comparisons
+// giving 1 or 0 and any non-zero value counting as true.
+type filterNode struct {
+  // op is the operator, or "num", "ident" or a function name for leaves.
+  op string
+  args []*filterNode
+  n int
+  // lit is the argument of contains and var, resolved against the input's names by bind.
+  lit string
+  resolved int32
+}
+
+// filterCtx is the clause a filter is evaluated on.
+type filterCtx struct {
+  clause []int32
+  index int
+  group int
+}
+
+func (n *filterNode) eval(c *filterCtx) int {
+  truth := func(b bool) int {
+    if b {
+      return 1
+    }
+    return 0
+  }
+  switch n.op {
+  case "num":
+    return n.n
+  case "len":
+    return len(c.clause)
+  case "pos", "neg":
+    count := 0
+    for _, l := range c.clause {
+      if (l > 0) == (n.op == "pos") {
+        count++
+      }
+    }
+    return count
+  case "index":
+    return c.index
+  case "group":
+    return c.group
+  case "contains", "var":
+    for _, l := range c.clause {
+      if l == n.resolved || (n.op == "var" && varOf(l) == varOf(n.resolved)) {
+        return 1
+      }
+    }
+    return 0
+  case "!":
+    return truth(n.args[0].eval(c) == 0)
+  case "&&":
+    return truth(n.args[0].eval(c) != 0 && n.args[1].eval(c) != 0)
+  case "||":
+    return truth(n.args[0].eval(c) != 0 || n.args[1].eval(c) != 0)
+  }
+  a, b := n.args[0].eval(c), n.args[1].eval(c)
+  switch n.op {
+  case "==":
+    return truth(a == b)
+  case "!=":
+    return truth(a != b)
+  case "<":
+    return truth(a < b)
+  case "<=":
+    return truth(a <= b)
+  case ">":
+    return truth(a > b)
+  }
+  return truth(a >= b)
+}
+
+// bind resolves the literals of contains and var against names.
+func (n *filterNode) bind(names map[int32]string) error {
+  for _, a := range n.args {
+    if err := a.bind(names); err != nil {
+      return err
+    }
+  }
+  if n.lit == "" {
+    return nil
+  }
+  neg := strings.HasPrefix(n.lit, "-")
+  name := strings.TrimPrefix(n.lit, "-")
+  v, err := strconv.ParseInt(name, 10, 32)
+  if err != nil || v <= 0 {
+    var named []int
+    for u, un := range names {
+      if un == name {
+        named = append(named, int(u))
+      }
+    }
+    if len(named) == 0 {
+      return fmt.Errorf("-filter: unknown variable %q", name)
+    }
+    // names are not unique, and map order would pick one at random.
+    if len(named) > 1 {
+      sort.Ints(named)
+      return fmt.Errorf("-filter: ambiguous variable name %q names variables %v", name, named)
+    }
+    v = int64(named[0])
+  }
+  n.resolved = int32(v)
+  if neg {
+    n.resolved = -n.resolved
+  }
+  return nil
+}
+
+// filterParser parses -filter expressions by recursive descent over tokens.
+type filterParser struct {
+  toks []string
+  pos int
+}
+
+func tokenizeFilter(expr string) ([]string, error) {
+  var toks []string
+  for i := 0; i < len(expr); {
+    ch := expr[i]
+    switch {
+    case ch == ' ' || ch == '\t':
+      i++
+    case strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||") ||
+      strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!=") ||
+      strings.HasPrefix(expr[i:], "<=") || strings.HasPrefix(expr[i:], ">="):
+      toks = append(toks, expr[i:i+2])
+      i += 2
+    case strings.ContainsRune("!<>(),-", rune(ch)):
+      toks = append(toks, expr[i:i+1])
+      i++
+    default:
+      j := i
+      for j < len(expr) && !strings.ContainsRune(" \t&|=!<>(),", rune(expr[j])) {
+        j++
+      }
+      if j == i {
+        return nil, fmt.Errorf("-filter: unexpected %q", expr[i:])
+      }
+      toks = append(toks, expr[i:j])
+      i = j
+    }
+  }
+  return toks, nil
+}
+
+// parseFilter parses a -filter expression:
+//
+//   expr := and ('||' and)*
+//   and := unary ('&&' unary)*
+//   unary := '!' unary | cmp
+//   cmp := term (('==' | '!=' | '<' | '<=' | '>' | '>=') term)?
+//   term := number | 'len' | 'pos' | 'neg' | 'index' | 'group' | ('contains' | 'var') '(' lit ')' | '(' expr ')'
+func parseFilter(expr string) (*filterNode, error) {
+  toks, err := tokenizeFilter(expr)
+  if err != nil {
+    return nil, err
+  }
+  p := &filterParser{toks: toks}
+  n, err := p.or()
+  if err == nil && p.pos < len(p.toks) {
+    err = fmt.Errorf("-filter: unexpected %q", p.toks[p.pos])
+  }
+  return n, err
+}
+
+func (p *filterParser) peek() string {
+  if p.pos < len(p.toks) {
+    return p.toks[p.pos]
+  }
+  return ""
+}
+
+func (p *filterParser) expect(tok string) error {
+  if p.peek() != tok {
+    return fmt.Errorf("-filter: expected %q, found %q", tok, p.peek())
+  }
+  p.pos++
+  return nil
+}
+
+func (p *filterParser) or() (*filterNode, error) {
+  n, err := p.and()
+  for err == nil && p.peek() == "||" {
+    p.pos++
+    var r *filterNode
+    r, err = p.and()
+    n = &filterNode{op: "||", args: []*filterNode{n, r}}
+  }
+  return n, err
+}
+
+func (p *filterParser) and() (*filterNode, error) {
+  n, err := p.unary()
+  for err == nil && p.peek() == "&&" {
+    p.pos++
+    var r *filterNode
+    r, err = p.unary()
+    n = &filterNode{op: "&&", args: []*filterNode{n, r}}
+  }
+  return n, err
+}
+
+func (p *filterParser) unary() (*filterNode, error) {
+  if p.peek() == "!" {
+    p.pos++
+    n, err := p.unary()
+    return &filterNode{op: "!", args: []*filterNode{n}}, err
+  }
+  n, err := p.term()
+  if err != nil {
+    return nil, err
+  }
+  switch op := p.peek(); op {
+  case "==", "!=", "<", "<=", ">", ">=":
+    p.pos++
+    r, err := p.term()
+    return &filterNode{op: op, args: []*filterNode{n, r}}, err
+  }
+  return n, nil
+}
+
+func (p *filterParser) term() (*filterNode, error) {
+  tok := p.peek()
+  p.pos++
+  switch tok {
+  case "len", "pos", "neg", "index", "group":
+    return &filterNode{op: tok}, nil
+  case "contains", "var":
+    if err := p.expect("("); err != nil {
+      return nil, err
+    }
+    lit := ""
+    if p.peek() == "-" {
+      lit = "-"
+      p.pos++
+    }
+    lit += p.peek()
+    p.pos++
+    return &filterNode{op: tok, lit: lit}, p.expect(")")
+  case "(":
+    n, err := p.or()
+    if err != nil {
+      return nil, err
+    }
+    return n, p.expect(")")
+  case "":
+    return nil, fmt.Errorf("-filter: unexpected end of expression")
+  }
+  v, err := strconv.Atoi(tok)
+  if err != nil {
+    return nil, fmt.Errorf("-filter: unexpected %q", tok)
+  }
+  return &filterNode{op: "num", n: v}, nil
+}
+
+// filterClauses keeps the clauses of f selected by the -filter expression, logging how many.
+func filterClauses(logger *log.Logger, path string, f *formula, expr *filterNode) error {
+  if err := expr.bind(f.names); err != nil {
+    return err
+  }
+  keep := make([]bool, len(f.clauses))
+  ctx := &filterCtx{}
+  for i, c := range f.clauses {
+    ctx.clause, ctx.index, ctx.group = c, i, 0
+    if f.gcnfGroups != nil {
+      ctx.group = f.gcnfGroups[i]
+    }
+    keep[i] = expr.eval(ctx) != 0
+  }
+  before := len(f.clauses)
+  n := keepClauses(f, keep)
+  logger.Printf("%s: -filter kept %d of %d clauses", path, n, before)
+  return nil
+}
+
+// compareClauses orders sorted clauses lexicographically, shorter clauses first among those
+// with a common prefix.
+func compareClauses(a, b []int32) int {
+  for i := 0; i < len(a) && i < len(b); i++ {
+    if a[i] != b[i] {
+      if a[i] < b[i] {
+        return -1
+      }
+      return 1
+    }
+  }
+  return len(a) - len(b)
+}
+
+// canonicalize sorts the literals of each clause of f and then the clauses, keeping each
+// clause's comment, GCNF group and line.
+func canonicalize(f *formula) {
+  for _, c := range f.clauses {
+    sortLits(c)
+  }
+  perm := make([]int, len(f.clauses))
+  for i := range perm {
+    perm[i] = i
+  }
+  sort.SliceStable(perm, func(i, j int) bool {
+    return compareClauses(f.clauses[perm[i]], f.clauses[perm[j]]) < 0
+  })
+  clauses := make([][]int32, len(perm))
+  groups := make([]int, len(perm))
+  lines := make([]int, len(perm))
+  for n, i := range perm {
+    clauses[n], groups[n], lines[n] = f.clauses[i], f.groups[i], f.lines[i]
+  }
+  f.clauses, f.groups, f.lines = clauses, groups, lines
+  if f.gcnfGroups != nil {
+    gcnfGroups := make([]int, len(perm))
+    for n, i := range perm {
+      gcnfGroups[n] = f.gcnfGroups[i]
+    }
+    f.gcnfGroups = gcnfGroups
+  }
+}
+
+// load parses the file at path, logging a header mismatch.
+func load(logger *log.Logger, path string) (*formula, error) {
+  f, err := parseFile(logger, path)
+  if err != nil {
+    return nil, fmt.Errorf("%s: %w", path, err)
+  }
+  if f.mismatch != nil {
+    logger.Printf("%s: %v", path, f.mismatch)
+  }
+  if *parseStats {
+    a := f.alloc
+    sizing := "header"
+    if a.Exact {
+      sizing = "exact"
+    } else if a.ReservedClauses == 0 {
+      sizing = "none"
+    }
+    logger.Printf("%s: %d clauses reserved (%s), grown %d times; %d literals in %d blocks of %d capacity",
+      path, a.ReservedClauses, sizing, a.ClauseGrowths, a.Literals, a.LiteralBlocks, a.LiteralCapacity)
+  }
+  return f, nil
+}
+
+// run writes the clause graph of the file at path to w, and its warnings, summaries and progress
+// reports to logger.
+func run(logger *log.Logger, path string, w io.Writer, out string) error {
+  f, err := load(logger, path)
+  if err != nil {
+    return err
+  }
+  denoise(logger, path, f)
+  if filter != nil {
+    if err := filterClauses(logger, path, f, filter); err != nil {
+      return err
+    }
+  }
+  if *canonical {
+    canonicalize(f)
+  }
+  if *classifyClauses {
+    f.classes = classify(f.clauses, f.gcnfGroups)
+    counts := make([]int, len(classNames))
+    for _, c := range f.classes {
+      counts[c]++
+    }
+    summary := make([]string, len(counts))
+    for c, n := range counts {
+      summary[c] = fmt.Sprintf("%d %s", n, classNames[c])
+    }
+    logger.Printf("%s: %s", path, strings.Join(summary, ", "))
+    if *showLines {
+      for i, c := range f.classes {
+        if c != irredundant {
+          logger.Printf("%s:%d: clause %d %s is %s", path, f.lines[i], i, clauseString(f.clauses[i], f.labelNames()), classNames[c])
+        }
+      }
+    }
+    if *corePath != "" {
+      if err := writeCore(*corePath, f); err != nil {
+        return err
+      }
+    }
+  }
+  for _, c := range f.clauses {
+    sortLits(c)
+  }
+  if f.gcnfGroups != nil && !*clusterComments {
+    clusterGCNF(f)
+  }
+  if *features {
+    return writeFeatures(logger, w, path, f)
+  }
+  annotateCentrality(logger, path, f)
+  if *communityDir != "" {
+    if err := writeCommunities(logger, *communityDir, path, f); err != nil {
+      return err
+    }
+  }
+  if *numSeparators > 0 {
+    seps, s := separators(logger, path, f, *numSeparators)
+    if *separatorDir != "" {
+      if err := writeSplit(logger, *separatorDir, path, f, seps, s); err != nil {
+        return err
+      }
+    }
+  }
+  if *outFormat == "edgelist" {
+    return edgeList(w, f)
+  }
+  switch *mode {
+  case "factor":
+    return factorGraph(w, f)
+  case "var":
+    return varGraph(w, f)
+  case "defs":
+    return definitionGraph(logger, w, path, f)
+  }
+  if *render == "" {
+    if out != "" && *shardSize > 0 && !*clusterComments && f.gcnfGroups == nil && mayExceed(f, *shardSize) {
+      return shardedGraph(logger, w, out, f)
+    }
+    return graph(logger, w, f, nil)
+  }
+  var edges []edge
+  if err := graph(logger, w, f, &edges); err != nil {
+    return err
+  }
+  return renderFile(*render, f, edges)
+}
+
+func main() {
+  flag.Var(&filePaths, "f", "File or directory of .cnf files to read graph from, may be repeated")
+  flag.Parse()
+  if len(filePaths) == 0 {
+    log.Fatalln("Must pass file")
+  }
+  switch *colorBy {
+  case "var", "polarity", "none":
+  default:
+    log.Fatalf("Unknown -color-by %q, expected var|polarity|none", *colorBy)
+  }
+  switch *mode {
+  case "clause", "factor", "var", "defs":
+  default:
+    log.Fatalf("Unknown -mode %q, expected clause|factor|var|defs", *mode)
+  }
+  switch *edgeLabels {
+  case "none", "label", "tooltip":
+  default:
+    log.Fatalf("Unknown -edge-labels %q, expected none|label|tooltip", *edgeLabels)
+  }
+  switch *centralityKind {
+  case "none", "pagerank", "eigenvector":
+  default:
+    log.Fatalf("Unknown -centrality %q, expected none|pagerank|eigenvector", *centralityKind)
+  }
+  switch *outFormat {
+  case "dot", "edgelist":
+  default:
+    log.Fatalf("Unknown -format %q, expected dot|edgelist", *outFormat)
+  }
+  if *outFormat == "edgelist" && *render != "" {
+    log.Fatalln("-render requires -format dot")
+  }
+  if *mode != "clause" && *render != "" {
+    log.Fatalln("-render only supports -mode clause")
+  }
+  if *mode == "defs" && (*outFormat != "dot" || *centralityKind != "none" || *communityDir != "") {
+    log.Fatalln("-mode defs does not support -format edgelist, -centrality or -communities")
+  }
+  if *mode == "var" && *outFormat != "dot" {
+    log.Fatalln("-mode var only supports -format dot")
+  }
+  if *heatmap && *mode != "var" {
+    log.Fatalln("-heatmap requires -mode var")
+  }
+  if *numSeparators < 0 {
+    log.Fatalln("-separators must not be negative")
+  }
+  if *separatorDir != "" && *numSeparators == 0 {
+    log.Fatalln("-separator-dir requires -separators")
+  }
+  if *separatorAssign != "" && *separatorDir == "" {
+    log.Fatalln("-separator-assign requires -separator-dir")
+  }
+  if *filterExpr != "" {
+    var err error
+    if filter, err = parseFilter(*filterExpr); err != nil {
+      log.Fatalln(err)
+    }
+  }
+  paths, err := inputs()
+  if err != nil {
+    log.Fatalln(err)
+  }
+  if *render != "" && len(paths) != 1 {
+    log.Fatalln("-render only supports a single input")
+  }
+  if *corePath != "" && (!*classifyClauses || len(paths) != 1) {
+    log.Fatalln("-core requires -classify and a single input")
+  }
+  if *nameTemplate == "{name}.dot" {
+    switch {
+    case *features:
+      *nameTemplate = "{name}.json"
+    case *outFormat == "edgelist":
+      *nameTemplate = "{name}.tsv"
+    }
+  }
+  logger := log.New(os.Stderr, "", log.LstdFlags)
+  if *comparePath != "" {
+    if len(paths) != 1 {
+      log.Fatalln("-compare requires a single input")
+    }
+    a, err := load(logger, paths[0])
+    if err != nil {
+      log.Fatalln(err)
+    }
+    b, err := load(logger, *comparePath)
+    if err != nil {
+      log.Fatalln(err)
+    }
+    if err := compare(logger, os.Stdout, paths[0], a, *comparePath, b); err != nil {
+      log.Fatalln(err)
+    }
+    return
+  }
+  if *outDir == "" {
+    if len(paths) != 1 {
+      log.Fatalln("Must pass -o when graphing more than one file")
+    }
+    if err := run(logger, paths[0], os.Stdout, ""); err != nil {
+      log.Fatalln(err)
+    }
+    return
+  }
+  single := strings.HasSuffix(*outDir, ".dot")
+  if single && len(paths) != 1 {
+    log.Fatalln("-o names a .dot file, which requires a single input")
+  }
+  if !single {
+    // inputs of the same name from different directories would overwrite each other's graph.
+    written := map[string]string{}
+    for _, path := range paths {
+      outPath := outputPath(path)
+      if prev, ok := written[outPath]; ok {
+        log.Fatalf("%s and %s would both be written to %s", prev, path, outPath)
+      }
+      written[outPath] = path
+    }
+    if err := os.MkdirAll(*outDir, 0755); err != nil {
+      log.Fatalln(err)
+    }
+  }
+  for _, path := range paths {
+    outPath := *outDir
+    if !single {
+      outPath = outputPath(path)
+    }
+    out, err := os.Create(outPath)
+    if err != nil {
+      log.Fatalln(err)
+    }
+    err = run(logger, path, out, outPath)
+    if cerr := out.Close(); err == nil {
+      err = cerr
+    }
+    if err != nil {
+      log.Fatalln(err)
+    }
+  }
 }
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+  "errors"
+  "os"
+)
+
+// mapFile always fails without mmap, so parseFile reads the file instead.
+func mapFile(file *os.File, size int64) ([]byte, func(), error) {
+  return nil, nil, errors.New("memory mapping is not supported on this system")
+}
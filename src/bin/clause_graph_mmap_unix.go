@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+  "fmt"
+  "os"
+  "syscall"
+)
+
+// mapFile maps size bytes of file read only. Tokens copy what they keep, so the mapping can be
+// released as soon as parsing is done.
+func mapFile(file *os.File, size int64) ([]byte, func(), error) {
+  if int64(int(size)) != size {
+    return nil, nil, fmt.Errorf("file of %d bytes is too large to map", size)
+  }
+  data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+  if err != nil {
+    return nil, nil, err
+  }
+  return data, func() { syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+// Run with `go test clause_graph.go clause_graph_mmap_unix.go clause_graph_test.go`, adding
+// `-fuzz FuzzParallel` or `-fuzz FuzzParse` to fuzz.
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata with the current output")
+
+// seeds are inputs the fuzz targets start from, along with the files in data/small.
+var seeds = []string{
+  "p cnf 3 2\n1 -2 0\n2 3 0\n",
+  "c a block\nc of comments\np cnf 3 2\n1 2\n 3 0\n-1 0\n",
+  "c var 1 x\np cnf 2 1\n-1 2 0\n0\n",
+  "p gcnf 2 2 1\n{0} 1 0\n{1} -1 2 0\n",
+  "p cnf 3 1\n1 2 3 0\n%\n0\n",
+  "p cnf 1 1\n2 0\n",
+  "1 x 0\n",
+}
+
+func addSeeds(f *testing.F) {
+  for _, s := range seeds {
+    f.Add([]byte(s))
+  }
+  paths, _ := filepath.Glob("data/small/*.cnf")
+  for _, path := range paths {
+    if data, err := os.ReadFile(path); err == nil {
+      f.Add(data)
+    }
+  }
+}
+
+// summary describes everything a parse produced but its allocation, which differs between the
+// sequential and parallel parsers, treating nil and empty slices alike.
+func summary(f *formula, err error) string {
+  if f == nil {
+    return fmt.Sprintf("error %v", err)
+  }
+  return fmt.Sprintf("%d %d %v %v %v %v %v %v %d %v error %v", f.vars, f.numClauses, f.clauses, f.groups,
+    f.groupNames, f.lines, f.names, f.gcnfGroups, f.numGCNFGroups, f.mismatch, err)
+}
+
+// FuzzParallel checks that parsing in parallel gives the same formula, or error, as parsing
+// sequentially.
+func FuzzParallel(f *testing.F) {
+  addSeeds(f)
+  f.Fuzz(func(t *testing.T, data []byte) {
+    want := summary(parseBytes(data, 1, nil))
+    for _, workers := range []int{2, 3, 7} {
+      if got := summary(parseBytes(data, workers, nil)); got != want {
+        t.Fatalf("%d workers parsed %q as\n%s\nbut 1 worker as\n%s", workers, data, got, want)
+      }
+    }
+  })
+}
+
+func TestOccurrencesOfClauseZero(t *testing.T) {
+  occurs := occurrences([][]int32{{-1, 2}, {1, -2, 3}})
+  want := []string{"[]", "[{0 true} {1 false}]", "[{0 false} {1 true}]", "[{1 false}]"}
+  if len(occurs) != len(want) {
+    t.Fatalf("got occurrences of %d variables, want %d", len(occurs), len(want))
+  }
+  for v, occ := range occurs {
+    if got := fmt.Sprint(occ); got != want[v] {
+      t.Errorf("variable %d occurs in %s, want %s", v, got, want[v])
+    }
+  }
+  if o := occurs.of(-1)[0]; !o.Matches(-1) || o.Matches(1) {
+    t.Errorf("occurrence %v of -1 in clause 0 should match -1 only", o)
+  }
+}
+
+func TestEdgesOfClauseZero(t *testing.T) {
+  tests := []struct {
+    clauses [][]int32
+    want []edge
+  }{
+    // a negative literal in clause 0 must not be mistaken for a positive one.
+    {[][]int32{{-1, 2}, {1, 3}}, []edge{{0, 1, 1, false}}},
+    {[][]int32{{-1, 2}, {-1, 3}}, []edge{{0, 1, 1, true}}},
+    {[][]int32{{-1, -2}, {1, -2}}, []edge{{0, 1, 1, false}, {0, 1, 2, true}}},
+    {[][]int32{{-1}, {2}, {-2, 1}}, []edge{{0, 2, 1, false}, {1, 2, 2, false}}},
+  }
+  for _, test := range tests {
+    var got []edge
+    forEachEdge(log.New(io.Discard, "", 0), &formula{clauses: test.clauses}, func(e edge) { got = append(got, e) })
+    if fmt.Sprint(got) != fmt.Sprint(test.want) {
+      t.Errorf("edges of %v are %v, want %v", test.clauses, got, test.want)
+    }
+  }
+}
+
+func TestFilterBindAmbiguousName(t *testing.T) {
+  names := map[int32]string{1: "x", 2: "y", 3: "x", 4: "x"}
+  for i := 0; i < 10; i++ {
+    expr, err := parseFilter("contains(-x)")
+    if err != nil {
+      t.Fatal(err)
+    }
+    err = expr.bind(names)
+    if err == nil || err.Error() != `-filter: ambiguous variable name "x" names variables [1 3 4]` {
+      t.Fatalf("binding a name of three variables gave error %v", err)
+    }
+  }
+  expr, err := parseFilter("contains(-y) || var(3)")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := expr.bind(names); err != nil {
+    t.Fatal(err)
+  }
+  if got := expr.args[0].resolved; got != -2 {
+    t.Errorf("-y resolved to %d, want -2", got)
+  }
+}
+
+// FuzzParse checks that the parser returns an error or a consistent formula for any input,
+// rather than panicking.
+func FuzzParse(f *testing.F) {
+  addSeeds(f)
+  f.Fuzz(func(t *testing.T, data []byte) {
+    form, err := parseBytes(data, 1, nil)
+    if (form == nil) == (err == nil) {
+      t.Fatalf("%q parsed to formula %v and error %v, expected exactly one", data, form, err)
+    }
+    if form == nil {
+      return
+    }
+    if len(form.groups) != len(form.clauses) || len(form.lines) != len(form.clauses) {
+      t.Fatalf("%q parsed to %d clauses with %d groups and %d lines", data, len(form.clauses), len(form.groups), len(form.lines))
+    }
+    for i, c := range form.clauses {
+      for _, l := range c {
+        if l == 0 || (form.vars != -1 && int(varOf(l)) > form.vars) {
+          t.Fatalf("%q parsed to clause %d %v outside the %d declared variables", data, i, c, form.vars)
+        }
+      }
+    }
+    if got := summary(parse(bytes.NewReader(data), nil)); got != summary(form, err) {
+      t.Fatalf("%q parsed from a reader as\n%s\nbut from bytes as\n%s", data, got, summary(form, err))
+    }
+  })
+}
+
+// permute writes a copy of the dimacs file at path to dir with the clauses and the literals of
+// each clause in reverse order, and returns its path.
+func permute(t *testing.T, path, dir string) string {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var head, clauses []string
+  for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+    fields := strings.Fields(line)
+    if len(fields) == 0 || fields[0] == "c" || fields[0] == "p" {
+      head = append(head, line)
+      continue
+    }
+    lits := fields[:len(fields)-1]
+    for i, j := 0, len(lits)-1; i < j; i, j = i+1, j-1 {
+      lits[i], lits[j] = lits[j], lits[i]
+    }
+    clauses = append([]string{strings.Join(lits, " ") + " 0"}, clauses...)
+  }
+  out := filepath.Join(dir, filepath.Base(path))
+  if err := os.WriteFile(out, []byte(strings.Join(append(head, clauses...), "\n")+"\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  return out
+}
+
+// TestCanonicalGolden checks that -canonical draws a permuted copy of an input like the golden
+// file drawn from the input itself. Run with -update to rewrite the golden files.
+func TestCanonicalGolden(t *testing.T) {
+  defer func(c bool, m string) { *canonical, *mode = c, m }(*canonical, *mode)
+  *canonical = true
+  for _, m := range []string{"clause", "factor"} {
+    *mode = m
+    golden := filepath.Join("testdata", "aim-50-1_6-yes."+m+".dot")
+    input := "data/small/aim-50-1_6-yes.cnf"
+    if !*update {
+      input = permute(t, input, t.TempDir())
+    }
+    var out bytes.Buffer
+    if err := run(log.New(io.Discard, "", 0), input, &out, ""); err != nil {
+      t.Fatal(err)
+    }
+    if *update {
+      if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+        t.Fatal(err)
+      }
+      continue
+    }
+    want, err := os.ReadFile(golden)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if !bytes.Equal(out.Bytes(), want) {
+      t.Errorf("-mode %s -canonical of a permuted %s differs from %s", m, input, golden)
+    }
+  }
+}
@@ -0,0 +1,208 @@
+/*
+A simple binary which conjoins several dimacs files into one, for composing the output of
+encoders.
+Can be run by `cnfcat a.cnf b.cnf ... > out.cnf`.
+
+By default the variables of each file are offset past those of the files before it, so the
+files share no variables. With `-merge`, variables named by the same `c var <n> <name>` comment
+in different files become one variable, and only unnamed variables are kept apart. Names are
+carried over to the output, qualified by the file name when two files use a name for different
+variables. The clauses of each file are preceded by a `c from <file>` comment, so
+`clause_graph -cluster-comments` shows which file each clause came from.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+var merge = flag.Bool("merge", false, "Merge variables with the same c var name across files instead of offsetting them")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// cnf is a parsed input file.
+type cnf struct {
+  path string
+  // vars is the larger of the header's variable count and the largest variable used.
+  vars int
+  clauses [][]int
+  names map[int]string
+}
+
+// maxLine is the longest line the parser accepts.
+const maxLine = 64 * 1024 * 1024
+
+func parse(path string, r io.Reader) (*cnf, error) {
+  f := &cnf{path: path, names: map[int]string{}}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          f.names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      parts := strings.Fields(t)
+      if len(parts) != 4 || parts[1] != "cnf" {
+        return nil, fmt.Errorf("line %d: expected header \"p cnf <vars> <clauses>\"", line)
+      }
+      v, err := strconv.Atoi(parts[2])
+      if err != nil || v < 0 {
+        return nil, fmt.Errorf("line %d: invalid variable count %s", line, parts[2])
+      }
+      f.vars = max(f.vars, v)
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        f.clauses = append(f.clauses, curr)
+        curr = nil
+      } else {
+        f.vars = max(f.vars, abs(item))
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return f, scanner.Err()
+}
+
+// conjoin maps the variables of each file to variables of the output, returning the mapping
+// of each file, the number of output variables and their names.
+func conjoin(files []*cnf) ([][]int, int, map[int]string) {
+  maps := make([][]int, len(files))
+  next := 0
+  byName := map[string]int{}
+  for i, f := range files {
+    maps[i] = make([]int, f.vars+1)
+    for v := 1; v <= f.vars; v++ {
+      if name, ok := f.names[v]; ok && *merge {
+        if w, ok := byName[name]; ok {
+          maps[i][v] = w
+          continue
+        }
+        next++
+        byName[name] = next
+        maps[i][v] = next
+        continue
+      }
+      next++
+      maps[i][v] = next
+    }
+  }
+  // uses counts the output variables each name is given to, to find names needing qualifying.
+  uses := map[string]map[int]bool{}
+  for i, f := range files {
+    for v, name := range f.names {
+      if v > f.vars {
+        continue
+      }
+      if uses[name] == nil {
+        uses[name] = map[int]bool{}
+      }
+      uses[name][maps[i][v]] = true
+    }
+  }
+  names := map[int]string{}
+  for i, f := range files {
+    base := filepath.Base(f.path)
+    base = strings.TrimSuffix(base, filepath.Ext(base))
+    for v, name := range f.names {
+      if v > f.vars {
+        continue
+      }
+      if len(uses[name]) > 1 {
+        name = base + "." + name
+      }
+      names[maps[i][v]] = name
+    }
+  }
+  return maps, next, names
+}
+
+func write(w io.Writer, files []*cnf) error {
+  maps, vars, names := conjoin(files)
+  b := bufio.NewWriter(w)
+  numClauses := 0
+  for _, f := range files {
+    numClauses += len(f.clauses)
+  }
+  ids := make([]int, 0, len(names))
+  for v := range names {
+    ids = append(ids, v)
+  }
+  sort.Ints(ids)
+  for _, v := range ids {
+    fmt.Fprintf(b, "c var %d %s\n", v, names[v])
+  }
+  fmt.Fprintf(b, "p cnf %d %d\n", vars, numClauses)
+  for i, f := range files {
+    fmt.Fprintf(b, "c from %s\n", f.path)
+    for _, c := range f.clauses {
+      for _, l := range c {
+        v := maps[i][abs(l)]
+        if l < 0 {
+          v = -v
+        }
+        fmt.Fprintf(b, "%d ", v)
+      }
+      b.WriteString("0\n")
+    }
+  }
+  return b.Flush()
+}
+
+func main() {
+  flag.Parse()
+  if flag.NArg() == 0 {
+    log.Fatalln("Must pass files")
+  }
+  var files []*cnf
+  for _, path := range flag.Args() {
+    file, err := os.Open(path)
+    if err != nil {
+      log.Fatalln(err)
+    }
+    f, err := parse(path, file)
+    file.Close()
+    if err != nil {
+      log.Fatalf("%s: %v", path, err)
+    }
+    files = append(files, f)
+  }
+  if err := write(os.Stdout, files); err != nil {
+    log.Fatalln(err)
+  }
+}
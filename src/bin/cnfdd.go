@@ -0,0 +1,413 @@
+/*
+A simple binary which shrinks a dimacs file while a command keeps behaving the same way on it,
+for turning a solver bug into a small reproducer.
+Can be run by `cnfdd -f <FILE> -o <OUT> -- <COMMAND> [ARGS]`, where `{}` in the arguments is
+replaced by the path of the candidate file, which is appended if there is no `{}`.
+
+A candidate is kept when the command exits with the same code as on the original file, or with
+`-exit <CODE>` if given. To minimize by a solver's answer rather than its exit code, wrap it in a
+script which exits with the answer, e.g. 10 for SAT and 20 for UNSAT. Clauses and then literals of
+the remaining clauses are removed by delta debugging until neither shrinks, and finally
+variables are renumbered to be contiguous. The smallest file found so far is always in `-o`, so the search
+can be interrupted.
+
+`-definitions` instead looks for the redundant parts of an encoding: the check is whatever
+semantic property the encoding must keep, and only whole definitions of auxiliary variables are
+removed, leaving the numbering alone. Auxiliary variables are those without a `c var` name, or
+with `-inputs <N>` those above N, and the definition of one is the clauses in which it is the
+largest auxiliary variable, as encoders usually define auxiliaries in terms of earlier ones.
+Clauses over inputs alone are always kept. The auxiliaries whose definitions could be removed
+are logged.
+*/
+package main
+
+import (
+  "bufio"
+  "context"
+  "errors"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "os/exec"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+var filePath = flag.String("f", "", "File to minimize")
+var outPath = flag.String("o", "", "File to write the minimized formula to")
+var exitCode = flag.Int("exit", -1, "Exit code to preserve, by default the command's exit code on the original file")
+var definitions = flag.Bool("definitions", false, "Only remove whole definitions of auxiliary variables, and report which are redundant")
+var inputs = flag.Int("inputs", 0, "With -definitions, the largest input variable, by default inputs are the variables named by c var comments")
+var timeout = flag.Duration("timeout", 0, "Time limit per run of the command, runs which exceed it are not kept")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// maxLine is the longest line the parser accepts.
+const maxLine = 64 * 1024 * 1024
+
+// parse returns the clauses of a dimacs file and the variable names given by
+// `c var <n> <name>` comments.
+func parse(r io.Reader) ([][]int, map[int]string, error) {
+  var clauses [][]int
+  names := map[int]string{}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        clauses = append(clauses, curr)
+        curr = nil
+      } else {
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, nil, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return clauses, names, scanner.Err()
+}
+
+func writeDimacs(path string, clauses [][]int) error {
+  vars := 0
+  for _, c := range clauses {
+    for _, l := range c {
+      vars = max(vars, abs(l))
+    }
+  }
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  w := bufio.NewWriter(file)
+  fmt.Fprintf(w, "p cnf %d %d\n", vars, len(clauses))
+  for _, c := range clauses {
+    for _, l := range c {
+      fmt.Fprintf(w, "%d ", l)
+    }
+    fmt.Fprintln(w, "0")
+  }
+  err = w.Flush()
+  if cerr := file.Close(); err == nil {
+    err = cerr
+  }
+  return err
+}
+
+// tester runs the command on candidate formulas. err is the first error running it, after
+// which no candidate is interesting.
+type tester struct {
+  command []string
+  scratch string
+  target  int
+  runs    int
+  err     error
+}
+
+// exit runs the command on clauses and returns its exit code, or -1 if it timed out.
+func (t *tester) exit(clauses [][]int) (int, error) {
+  if err := writeDimacs(t.scratch, clauses); err != nil {
+    return 0, err
+  }
+  t.runs++
+  ctx := context.Background()
+  if *timeout > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, *timeout)
+    defer cancel()
+  }
+  args := make([]string, 0, len(t.command))
+  replaced := false
+  for _, a := range t.command[1:] {
+    if strings.Contains(a, "{}") {
+      replaced = true
+    }
+    args = append(args, strings.ReplaceAll(a, "{}", t.scratch))
+  }
+  if !replaced {
+    args = append(args, t.scratch)
+  }
+  cmd := exec.CommandContext(ctx, t.command[0], args...)
+  err := cmd.Run()
+  if ctx.Err() != nil {
+    return -1, nil
+  }
+  var exitErr *exec.ExitError
+  if errors.As(err, &exitErr) {
+    return exitErr.ExitCode(), nil
+  }
+  if err != nil {
+    return 0, err
+  }
+  return 0, nil
+}
+
+// interesting reports whether the command still exits with the target code on clauses, and
+// if so saves them to -o.
+func (t *tester) interesting(clauses [][]int) bool {
+  if t.err != nil {
+    return false
+  }
+  code, err := t.exit(clauses)
+  if err == nil && code == t.target {
+    err = writeDimacs(*outPath, clauses)
+  }
+  if err != nil {
+    t.err = err
+    return false
+  }
+  return code == t.target
+}
+
+// reduce removes as many items as it can while test holds, by removing chunks of the items and
+// halving the chunk size when no chunk can be removed. This is the complement half of ddmin.
+func reduce[T any](items []T, test func([]T) bool) []T {
+  if len(items) > 0 && test(nil) {
+    return nil
+  }
+  n := 2
+  for len(items) >= 2 {
+    chunk := (len(items) + n - 1) / n
+    reduced := false
+    for start := 0; start < len(items); start += chunk {
+      cand := append(append([]T{}, items[:start]...), items[min(start+chunk, len(items)):]...)
+      if test(cand) {
+        items = cand
+        n = max(n-1, 2)
+        reduced = true
+        break
+      }
+    }
+    if !reduced {
+      if n >= len(items) {
+        break
+      }
+      n = min(2*n, len(items))
+    }
+  }
+  return items
+}
+
+// renumber maps the variables of clauses onto 1..n in order of first occurrence.
+func renumber(clauses [][]int) [][]int {
+  ids := map[int]int{}
+  out := make([][]int, len(clauses))
+  for i, c := range clauses {
+    out[i] = make([]int, len(c))
+    for j, l := range c {
+      v, ok := ids[abs(l)]
+      if !ok {
+        v = len(ids) + 1
+        ids[abs(l)] = v
+      }
+      if l < 0 {
+        v = -v
+      }
+      out[i][j] = v
+    }
+  }
+  return out
+}
+
+// definitionGroups splits clauses into those over inputs alone and the definition of each
+// auxiliary variable, the clauses in which it is the largest auxiliary. It returns the indices
+// of the clauses of each, and the auxiliary each definition defines.
+func definitionGroups(clauses [][]int, isInput func(v int) bool) ([]int, [][]int, []int) {
+  var fixed []int
+  byAux := map[int][]int{}
+  for i, c := range clauses {
+    aux := 0
+    for _, l := range c {
+      if !isInput(abs(l)) {
+        aux = max(aux, abs(l))
+      }
+    }
+    if aux == 0 {
+      fixed = append(fixed, i)
+      continue
+    }
+    byAux[aux] = append(byAux[aux], i)
+  }
+  auxs := make([]int, 0, len(byAux))
+  for v := range byAux {
+    auxs = append(auxs, v)
+  }
+  sort.Ints(auxs)
+  groups := make([][]int, len(auxs))
+  for i, v := range auxs {
+    groups[i] = byAux[v]
+  }
+  return fixed, groups, auxs
+}
+
+// reduceDefinitions removes as many definitions as the command allows, returning the remaining
+// clauses, the auxiliaries whose definitions were removed, and the number of clauses over inputs
+// alone and of definitions it started from. Without -inputs, the named variables are the inputs.
+func reduceDefinitions(t *tester, clauses [][]int, names map[int]string) ([][]int, []int, int, int) {
+  isInput := func(v int) bool {
+    if *inputs > 0 {
+      return v <= *inputs
+    }
+    _, ok := names[v]
+    return ok
+  }
+  fixed, groups, auxs := definitionGroups(clauses, isInput)
+  // assemble keeps the clauses of the given definitions, in their original order.
+  assemble := func(kept []int) [][]int {
+    keep := make([]bool, len(clauses))
+    for _, i := range fixed {
+      keep[i] = true
+    }
+    for _, g := range kept {
+      for _, i := range groups[g] {
+        keep[i] = true
+      }
+    }
+    var out [][]int
+    for i, c := range clauses {
+      if keep[i] {
+        out = append(out, c)
+      }
+    }
+    return out
+  }
+  all := make([]int, len(groups))
+  for i := range all {
+    all[i] = i
+  }
+  kept := reduce(all, func(gs []int) bool { return t.interesting(assemble(gs)) })
+  isKept := map[int]bool{}
+  for _, g := range kept {
+    isKept[g] = true
+  }
+  var removed []int
+  for g, v := range auxs {
+    if !isKept[g] {
+      removed = append(removed, v)
+    }
+  }
+  return assemble(kept), removed, len(fixed), len(groups)
+}
+
+func literals(clauses [][]int) int {
+  n := 0
+  for _, c := range clauses {
+    n += len(c)
+  }
+  return n
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" || *outPath == "" {
+    log.Fatalln("Must pass file and output")
+  }
+  if flag.NArg() == 0 {
+    log.Fatalln("Must pass a command to run on candidates")
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  clauses, names, err := parse(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  scratch, err := os.CreateTemp("", "cnfdd-*.cnf")
+  if err != nil {
+    log.Fatalln(err)
+  }
+  scratch.Close()
+  defer os.Remove(scratch.Name())
+  t := &tester{command: flag.Args(), scratch: scratch.Name()}
+  start := time.Now()
+  t.target, err = t.exit(clauses)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  if *exitCode != -1 && t.target != *exitCode {
+    log.Fatalf("command exits with %d on the original file, not %d", t.target, *exitCode)
+  }
+  if t.target == -1 {
+    log.Fatalln("command times out on the original file")
+  }
+  if err := writeDimacs(*outPath, clauses); err != nil {
+    log.Fatalln(err)
+  }
+  log.Printf("preserving exit code %d, starting from %d clauses", t.target, len(clauses))
+
+  if *definitions {
+    var removed []int
+    var fixed, defs int
+    clauses, removed, fixed, defs = reduceDefinitions(t, clauses, names)
+    if t.err != nil {
+      log.Fatalln(t.err)
+    }
+    log.Printf("%d clauses over inputs alone and %d definitions", fixed, defs)
+    parts := make([]string, len(removed))
+    for i, v := range removed {
+      parts[i] = strconv.Itoa(v)
+    }
+    log.Printf("redundant definitions: %d, of auxiliaries %s", len(removed), strings.Join(parts, " "))
+    log.Printf("wrote %d clauses to %s after %d runs in %v", len(clauses), *outPath, t.runs,
+      time.Since(start).Round(time.Millisecond))
+    return
+  }
+  // removing literals can make more clauses removable, so repeat until neither shrinks.
+  for {
+    size := len(clauses) + literals(clauses)
+    clauses = reduce(clauses, t.interesting)
+    for i := range clauses {
+      clauses[i] = reduce(clauses[i], func(c []int) bool {
+        cand := append([][]int{}, clauses...)
+        cand[i] = c
+        return t.interesting(cand)
+      })
+    }
+    log.Printf("%d clauses and %d literals remain", len(clauses), literals(clauses))
+    if len(clauses)+literals(clauses) == size {
+      break
+    }
+  }
+  if cand := renumber(clauses); t.interesting(cand) {
+    clauses = cand
+  }
+  if t.err != nil {
+    log.Fatalln(t.err)
+  }
+  log.Printf("wrote %d clauses and %d literals to %s after %d runs in %v", len(clauses),
+    literals(clauses), *outPath, t.runs, time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,321 @@
+/*
+A simple binary which hashes dimacs files by a canonical form, so that benchmark deduplication
+and result caches can key on the formula rather than on the file.
+Can be run by `cnfhash a.cnf b.cnf ...`, which writes a line with the hash and path of each file
+like sha256sum, or with `-print` the canonical form of each file instead.
+
+The canonical form sorts the literals of each clause and the clauses, and removes duplicate
+literals and clauses. Unless `-rename=false` it also renumbers variables and chooses their
+polarity by color refinement: literals and clauses are repeatedly colored by the colors of their
+neighbours until the coloring is stable, each variable's positive literal becomes the one with
+the smaller color, and variables are numbered in order of their colors. Renamed or flipped
+copies of a formula then hash the same. Variables which refinement leaves tied are separated by
+giving one of them a color of its own and refining again, without the backtracking search of a
+full canonical labeling, so this is a heuristic: if the tied variables are not symmetric, which
+one is picked depends on the input's numbering and copies may hash differently. Equal hashes
+still mean the formulas are equal up to renaming and polarity.
+*/
+package main
+
+import (
+  "bufio"
+  "bytes"
+  "crypto/sha256"
+  "encoding/binary"
+  "flag"
+  "fmt"
+  "hash/fnv"
+  "io"
+  "log"
+  "os"
+  "slices"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+var printForm = flag.Bool("print", false, "Write the canonical form of each file instead of its hash")
+var rename = flag.Bool("rename", true, "Renumber variables and normalize their polarity, so renamed copies hash the same")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// maxLine is the longest line the parser accepts.
+const maxLine = 64 * 1024 * 1024
+
+// parse returns the clauses of r and the number of variables, the larger of the header's and
+// the largest used.
+func parse(r io.Reader) ([][]int, int, error) {
+  var clauses [][]int
+  var curr []int
+  vars := 0
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      parts := strings.Fields(t)
+      if len(parts) == 4 {
+        if v, err := strconv.Atoi(parts[2]); err == nil {
+          vars = max(vars, v)
+        }
+      }
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, 0, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        clauses = append(clauses, curr)
+        curr = nil
+      } else {
+        vars = max(vars, abs(item))
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, 0, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return clauses, vars, scanner.Err()
+}
+
+// lit is the index of literal l among the literals of the formula, 2(v-1) for v and one more
+// for -v.
+func lit(l int) int {
+  if l > 0 {
+    return 2 * (l - 1)
+  }
+  return 2*(-l-1) + 1
+}
+
+// relabel replaces each signature by its rank among the distinct signatures, so the colors do
+// not depend on the order of the nodes.
+func relabel(sigs []uint64) ([]int, int) {
+  distinct := append([]uint64{}, sigs...)
+  sort.Slice(distinct, func(i, j int) bool { return distinct[i] < distinct[j] })
+  rank := map[uint64]int{}
+  for _, s := range distinct {
+    if _, ok := rank[s]; !ok {
+      rank[s] = len(rank)
+    }
+  }
+  colors := make([]int, len(sigs))
+  for i, s := range sigs {
+    colors[i] = rank[s]
+  }
+  return colors, len(rank)
+}
+
+// signature hashes the node's color and the sorted colors of its neighbours. Two signatures
+// colliding only merges their colors, which keeps the coloring independent of the numbering.
+func signature(color int, neighbours []int) uint64 {
+  sort.Ints(neighbours)
+  h := fnv.New64a()
+  var buf [8]byte
+  binary.LittleEndian.PutUint64(buf[:], uint64(color))
+  h.Write(buf[:])
+  for _, n := range neighbours {
+    binary.LittleEndian.PutUint64(buf[:], uint64(n))
+    h.Write(buf[:])
+  }
+  return h.Sum64()
+}
+
+// refine refines the colors of the literals of clauses by color refinement of the graph joining
+// each clause to its literals and each literal to its complement, until the number of colors
+// stops growing.
+func refine(clauses [][]int, occurs [][]int, litColors []int) []int {
+  clauseColors := make([]int, len(clauses))
+  count := len(slices.Compact(slices.Sorted(slices.Values(litColors))))
+  for {
+    sigs := make([]uint64, len(clauses))
+    for i, c := range clauses {
+      neighbours := make([]int, len(c))
+      for j, l := range c {
+        neighbours[j] = litColors[lit(l)]
+      }
+      sigs[i] = signature(clauseColors[i], neighbours)
+    }
+    clauseColors, _ = relabel(sigs)
+    sigs = make([]uint64, len(litColors))
+    for i := range sigs {
+      // i^1 is the complement of literal i, whose color is hashed in as well.
+      neighbours := make([]int, len(occurs[i]))
+      for j, c := range occurs[i] {
+        neighbours[j] = clauseColors[c]
+      }
+      sigs[i] = signature(litColors[i], neighbours)*31 + signature(litColors[i^1], nil)
+    }
+    var n int
+    litColors, n = relabel(sigs)
+    if n == count {
+      return litColors
+    }
+    count = n
+  }
+}
+
+// canonical returns the canonical form of clauses over vars variables.
+func canonical(clauses [][]int, vars int, rename bool) [][]int {
+  // mapping[v] is the literal variable v becomes.
+  mapping := make([]int, vars+1)
+  for v := range mapping {
+    mapping[v] = v
+  }
+  if rename {
+    occurs := make([][]int, 2*vars)
+    for i, c := range clauses {
+      for _, l := range c {
+        occurs[lit(l)] = append(occurs[lit(l)], i)
+      }
+    }
+    colors := refine(clauses, occurs, make([]int, 2*vars))
+    // individualize a literal of a tied variable and refine again until no variables which
+    // occur are tied. Any choice gives the same result when the tied variables are symmetric.
+    for {
+      // cells maps the colors of a variable's literals to the first variable with them, and
+      // tied is the first variable of the smallest cell with several variables or with equally
+      // colored literals.
+      cells := map[[2]int]int{}
+      var tied int
+      var tiedCell [2]int
+      for v := 1; v <= vars; v++ {
+        pos, neg := colors[lit(v)], colors[lit(-v)]
+        if len(occurs[lit(v)])+len(occurs[lit(-v)]) == 0 {
+          continue
+        }
+        cell := [2]int{min(pos, neg), max(pos, neg)}
+        first, ok := cells[cell]
+        if !ok {
+          cells[cell] = v
+          first = v
+        }
+        if (ok || pos == neg) && (tied == 0 || cell[0] < tiedCell[0] || (cell[0] == tiedCell[0] && cell[1] < tiedCell[1])) {
+          tied, tiedCell = first, cell
+        }
+      }
+      if tied == 0 {
+        break
+      }
+      next := make([]int, len(colors))
+      for i, c := range colors {
+        next[i] = 2 * c
+      }
+      next[lit(tied)]++
+      colors = refine(clauses, occurs, next)
+    }
+    order := make([]int, vars)
+    for i := range order {
+      order[i] = i + 1
+    }
+    // key returns the colors of v's literals, the smaller one first, and whether v is flipped.
+    key := func(v int) (int, int, bool) {
+      pos, neg := colors[lit(v)], colors[lit(-v)]
+      if neg < pos {
+        return neg, pos, true
+      }
+      return pos, neg, false
+    }
+    sort.SliceStable(order, func(i, j int) bool {
+      a0, a1, _ := key(order[i])
+      b0, b1, _ := key(order[j])
+      if a0 != b0 {
+        return a0 < b0
+      }
+      return a1 < b1
+    })
+    for i, v := range order {
+      mapping[v] = i + 1
+      if _, _, flip := key(v); flip {
+        mapping[v] = -(i + 1)
+      }
+    }
+  }
+  out := make([][]int, 0, len(clauses))
+  for _, c := range clauses {
+    seen := map[int]bool{}
+    var mapped []int
+    for _, l := range c {
+      m := mapping[abs(l)]
+      if l < 0 {
+        m = -m
+      }
+      if !seen[m] {
+        seen[m] = true
+        mapped = append(mapped, m)
+      }
+    }
+    sort.Ints(mapped)
+    out = append(out, mapped)
+  }
+  sort.Slice(out, func(i, j int) bool {
+    a, b := out[i], out[j]
+    for k := 0; k < len(a) && k < len(b); k++ {
+      if a[k] != b[k] {
+        return a[k] < b[k]
+      }
+    }
+    return len(a) < len(b)
+  })
+  kept := out[:0]
+  for i, c := range out {
+    if i > 0 && slices.Equal(c, kept[len(kept)-1]) {
+      continue
+    }
+    kept = append(kept, c)
+  }
+  return kept
+}
+
+func writeDimacs(w io.Writer, clauses [][]int, vars int) {
+  fmt.Fprintf(w, "p cnf %d %d\n", vars, len(clauses))
+  for _, c := range clauses {
+    for _, l := range c {
+      fmt.Fprintf(w, "%d ", l)
+    }
+    fmt.Fprintln(w, "0")
+  }
+}
+
+func main() {
+  flag.Parse()
+  if flag.NArg() == 0 {
+    log.Fatalln("Must pass files")
+  }
+  out := bufio.NewWriter(os.Stdout)
+  defer out.Flush()
+  for _, path := range flag.Args() {
+    file, err := os.Open(path)
+    if err != nil {
+      log.Fatalln(err)
+    }
+    clauses, vars, err := parse(file)
+    file.Close()
+    if err != nil {
+      log.Fatalf("%s: %v", path, err)
+    }
+    clauses = canonical(clauses, vars, *rename)
+    if *printForm {
+      writeDimacs(out, clauses, vars)
+      continue
+    }
+    var b bytes.Buffer
+    writeDimacs(&b, clauses, vars)
+    fmt.Fprintf(out, "%x  %s\n", sha256.Sum256(b.Bytes()), path)
+  }
+}
@@ -0,0 +1,283 @@
+/*
+A simple binary which encodes coloring a graph in the DIMACS graph (.col) format with k colors as
+a CNF, and decodes a solver's model back into the coloring.
+Can be run by `coloring -f <GRAPH> -k 3 > out.cnf`, and then with `-model <FILE>` on the solver's
+output to print the color of each vertex. With a solver command after `--`, as in
+`coloring -f <GRAPH> -k 3 -- kissat`, the CNF is solved and the coloring printed directly. `{}`
+in the command's arguments is replaced by the path of the CNF, which is appended if there is no
+`{}`, and the command must write its answer to stdout in the competition format.
+
+The graph is read as `p edge <vertices> <edges>` followed by an `e <u> <v>` line per edge, with
+vertices numbered from 1. Vertex v has color c, counting from 1, if variable (v-1)*k+c is true,
+named `v<v>=<c>` by a `c var` comment. Every vertex has exactly one color, and the ends of an
+edge have different colors, so a graph with a loop has no coloring. The coloring is printed as a
+`<vertex> <color>` line per vertex.
+*/
+package main
+
+import (
+  "bufio"
+  "errors"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "os/exec"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "DIMACS graph to color")
+var k = flag.Int("k", 3, "Number of colors")
+var modelPath = flag.String("model", "", "Decode this solver output into a coloring instead of encoding")
+
+type graph struct {
+  vertices int
+  edges [][2]int
+}
+
+// maxLine is the longest line of a graph or a solver's output that is accepted.
+const maxLine = 64 * 1024 * 1024
+
+func parseGraph(r io.Reader) (*graph, error) {
+  g := &graph{vertices: -1}
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    parts := strings.Fields(scanner.Text())
+    if len(parts) == 0 || parts[0] == "c" {
+      continue
+    }
+    switch parts[0] {
+    case "p":
+      if len(parts) != 4 || (parts[1] != "edge" && parts[1] != "col") {
+        return nil, fmt.Errorf("line %d: expected header \"p edge <vertices> <edges>\"", line)
+      }
+      n, err := strconv.Atoi(parts[2])
+      if err != nil || n < 0 {
+        return nil, fmt.Errorf("line %d: invalid vertex count %s", line, parts[2])
+      }
+      g.vertices = n
+    case "e":
+      if g.vertices == -1 {
+        return nil, fmt.Errorf("line %d: edge before header", line)
+      }
+      if len(parts) != 3 {
+        return nil, fmt.Errorf("line %d: expected \"e <u> <v>\"", line)
+      }
+      var e [2]int
+      for i, part := range parts[1:] {
+        v, err := strconv.Atoi(part)
+        if err != nil || v < 1 || v > g.vertices {
+          return nil, fmt.Errorf("line %d: invalid vertex %s", line, part)
+        }
+        e[i] = v
+      }
+      g.edges = append(g.edges, e)
+    default:
+      return nil, fmt.Errorf("line %d: unknown line type %q", line, parts[0])
+    }
+  }
+  if g.vertices == -1 {
+    return nil, fmt.Errorf("missing header")
+  }
+  return g, scanner.Err()
+}
+
+// colorVar is the variable which is true if vertex v has color c.
+func colorVar(v, c, k int) int { return (v-1)*k + c }
+
+// encode returns the clauses requiring a coloring of g with k colors.
+func encode(g *graph, k int) [][]int {
+  var clauses [][]int
+  for v := 1; v <= g.vertices; v++ {
+    some := make([]int, k)
+    for c := 1; c <= k; c++ {
+      some[c-1] = colorVar(v, c, k)
+      for d := c + 1; d <= k; d++ {
+        clauses = append(clauses, []int{-colorVar(v, c, k), -colorVar(v, d, k)})
+      }
+    }
+    clauses = append(clauses, some)
+  }
+  for _, e := range g.edges {
+    for c := 1; c <= k; c++ {
+      if e[0] == e[1] {
+        clauses = append(clauses, []int{-colorVar(e[0], c, k)})
+      } else {
+        clauses = append(clauses, []int{-colorVar(e[0], c, k), -colorVar(e[1], c, k)})
+      }
+    }
+  }
+  return clauses
+}
+
+func writeDimacs(w io.Writer, g *graph, k int) error {
+  clauses := encode(g, k)
+  b := bufio.NewWriter(w)
+  for v := 1; v <= g.vertices; v++ {
+    for c := 1; c <= k; c++ {
+      fmt.Fprintf(b, "c var %d v%d=%d\n", colorVar(v, c, k), v, c)
+    }
+  }
+  fmt.Fprintf(b, "p cnf %d %d\n", g.vertices*k, len(clauses))
+  for _, c := range clauses {
+    for _, l := range c {
+      fmt.Fprintf(b, "%d ", l)
+    }
+    b.WriteString("0\n")
+  }
+  return b.Flush()
+}
+
+// decode returns the color of each vertex, from 1, in the model in r, and false if the solver
+// reported no model.
+func decode(r io.Reader, g *graph, k int) ([]int, bool, error) {
+  colors := make([]int, g.vertices+1)
+  found := false
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    parts := strings.Fields(scanner.Text())
+    if len(parts) == 0 || parts[0] == "c" {
+      continue
+    }
+    if parts[0] == "s" {
+      if len(parts) > 1 && parts[1] == "UNSATISFIABLE" {
+        return nil, false, nil
+      }
+      continue
+    }
+    if parts[0] == "v" {
+      parts = parts[1:]
+    }
+    for _, part := range parts {
+      l, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, false, fmt.Errorf("line %d: invalid literal %s", line, part)
+      }
+      found = true
+      if l > 0 && l <= g.vertices*k {
+        colors[(l-1)/k+1] = (l-1)%k + 1
+      }
+    }
+  }
+  if err := scanner.Err(); err != nil || !found {
+    return nil, false, err
+  }
+  for v := 1; v <= g.vertices; v++ {
+    if colors[v] == 0 {
+      return nil, false, fmt.Errorf("the model gives vertex %d no color", v)
+    }
+  }
+  return colors[1:], true, nil
+}
+
+// solve writes the CNF coloring g with k colors to scratch and runs command on it, returning the
+// coloring it found and true, or false if there is none.
+func solve(command []string, scratch string, g *graph, k int) ([]int, bool, error) {
+  file, err := os.Create(scratch)
+  if err != nil {
+    return nil, false, err
+  }
+  err = writeDimacs(file, g, k)
+  if cerr := file.Close(); err == nil {
+    err = cerr
+  }
+  if err != nil {
+    return nil, false, err
+  }
+  args := make([]string, 0, len(command))
+  replaced := false
+  for _, a := range command[1:] {
+    if strings.Contains(a, "{}") {
+      replaced = true
+    }
+    args = append(args, strings.ReplaceAll(a, "{}", scratch))
+  }
+  if !replaced {
+    args = append(args, scratch)
+  }
+  cmd := exec.Command(command[0], args...)
+  cmd.Stderr = os.Stderr
+  out, err := cmd.Output()
+  // solvers exit with 10 or 20 to report their answer.
+  var exitErr *exec.ExitError
+  if err != nil && !errors.As(err, &exitErr) {
+    return nil, false, err
+  }
+  colors, ok, err := decode(strings.NewReader(string(out)), g, k)
+  if err == nil && !ok && !strings.Contains(string(out), "UNSATISFIABLE") {
+    err = fmt.Errorf("%s gave neither a model nor UNSATISFIABLE", command[0])
+  }
+  return colors, ok, err
+}
+
+func printColoring(w io.Writer, colors []int) {
+  for v, c := range colors {
+    fmt.Fprintf(w, "%d %d\n", v+1, c)
+  }
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  if *k < 0 {
+    log.Fatalln("-k must not be negative")
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  g, err := parseGraph(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  if flag.NArg() > 0 {
+    scratch, err := os.CreateTemp("", "coloring-*.cnf")
+    if err != nil {
+      log.Fatalln(err)
+    }
+    scratch.Close()
+    defer os.Remove(scratch.Name())
+    colors, ok, err := solve(flag.Args(), scratch.Name(), g, *k)
+    if err != nil {
+      log.Fatalln(err)
+    }
+    if !ok {
+      fmt.Printf("no coloring with %d colors\n", *k)
+      os.Remove(scratch.Name())
+      os.Exit(1)
+    }
+    printColoring(os.Stdout, colors)
+    return
+  }
+  if *modelPath == "" {
+    if err := writeDimacs(os.Stdout, g, *k); err != nil {
+      log.Fatalln(err)
+    }
+    return
+  }
+  model, err := os.Open(*modelPath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  colors, ok, err := decode(model, g, *k)
+  model.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *modelPath, err)
+  }
+  if !ok {
+    fmt.Printf("no coloring with %d colors\n", *k)
+    return
+  }
+  printColoring(os.Stdout, colors)
+}
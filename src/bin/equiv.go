@@ -0,0 +1,339 @@
+/*
+A simple binary which checks whether two dimacs files are equivalent, that is have the same
+models, and otherwise finds an assignment on which they differ.
+Can be run by `equiv -a <FILE> -b <FILE> -- kissat`, or without a solver command to write the
+miter to stdout.
+
+The miter is satisfied exactly by the assignments which satisfy one input and falsify the other.
+A selector variable, numbered after the inputs' variables and named `a-not-b`, picks the
+direction: when it is true the clauses of a hold along with the negation of b, and when it is
+false those of b with the negation of a. Each negation is encoded as by negate, with an
+auxiliary variable per clause which implies the clause's negated literals, numbered after the
+selector, so the inputs are equivalent iff the miter is unsatisfiable. Variables are matched
+by number, and every variable is compared, so auxiliaries such as Tseitin variables must be
+numbered alike in both inputs, and an input with an auxiliary the other lacks is only
+equivalent to it if it does not depend on the auxiliary. `c var` names are kept, and those of a
+are used where both name a variable.
+
+`{}` in the command's arguments is replaced by the path of the miter, which is appended if
+there is no `{}`, and the command must write its answer to stdout in the competition format.
+The inputs are only reported equivalent when the solver answers UNSATISFIABLE, or exits with 20
+without an `s` line. Otherwise the distinguishing assignment is printed with the input it
+satisfies, and the exit code is 1, or if the solver gives up without a model, such as with
+UNKNOWN after a timeout, `unknown` is printed and the exit code is 2.
+*/
+package main
+
+import (
+  "bufio"
+  "errors"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "os/exec"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+var aPath = flag.String("a", "", "First file to compare")
+var bPath = flag.String("b", "", "Second file to compare")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// formula is a parsed input, vars is the larger of the header's variable count and the largest
+// variable used.
+type formula struct {
+  vars    int
+  clauses [][]int
+  names   map[int]string
+}
+
+// maxLine is the longest line of an input or of solver output that is accepted.
+const maxLine = 64 * 1024 * 1024
+
+func parse(r io.Reader) (*formula, error) {
+  f := &formula{names: map[int]string{}}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          f.names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      parts := strings.Fields(t)
+      if len(parts) == 4 {
+        if v, err := strconv.Atoi(parts[2]); err == nil {
+          f.vars = max(f.vars, v)
+        }
+      }
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        f.clauses = append(f.clauses, curr)
+        curr = nil
+      } else {
+        f.vars = max(f.vars, abs(item))
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return f, scanner.Err()
+}
+
+// miter is the encoding of the assignments on which a and b differ.
+type miter struct {
+  // vars is the number of variables of the inputs, and vars+1 is the selector.
+  vars int
+  // aux is the number of variables used, including the auxiliaries of the negations.
+  aux     int
+  clauses [][]int
+  names   map[int]string
+}
+
+// negation adds the negation of f to m, with auxiliaries from m.aux+1 onwards, and the clause
+// requiring one of them to be true guarded by sel.
+func (m *miter) negation(f *formula, name string, sel int) {
+  some := []int{-sel}
+  for i, c := range f.clauses {
+    m.aux++
+    some = append(some, m.aux)
+    m.names[m.aux] = name + strconv.Itoa(i+1)
+    for _, l := range c {
+      m.clauses = append(m.clauses, []int{-m.aux, -l})
+    }
+  }
+  m.clauses = append(m.clauses, some)
+}
+
+func newMiter(a, b *formula) *miter {
+  m := &miter{vars: max(a.vars, b.vars), names: map[int]string{}}
+  sel := m.vars + 1
+  m.aux = sel
+  for v, name := range b.names {
+    m.names[v] = name
+  }
+  for v, name := range a.names {
+    m.names[v] = name
+  }
+  taken := map[string]bool{}
+  for _, name := range m.names {
+    taken[name] = true
+  }
+  m.names[sel] = "a-not-b"
+  for _, c := range a.clauses {
+    m.clauses = append(m.clauses, append(append([]int{}, c...), -sel))
+  }
+  for _, c := range b.clauses {
+    m.clauses = append(m.clauses, append(append([]int{}, c...), sel))
+  }
+  m.negation(b, "b-clause", sel)
+  m.negation(a, "a-clause", -sel)
+  // auxiliaries whose names the inputs already use stay unnamed.
+  for v := sel; v <= m.aux; v++ {
+    if taken[m.names[v]] {
+      delete(m.names, v)
+    }
+  }
+  return m
+}
+
+func (m *miter) write(w io.Writer) error {
+  b := bufio.NewWriter(w)
+  vars := make([]int, 0, len(m.names))
+  for v := range m.names {
+    vars = append(vars, v)
+  }
+  sort.Ints(vars)
+  for _, v := range vars {
+    fmt.Fprintf(b, "c var %d %s\n", v, m.names[v])
+  }
+  fmt.Fprintf(b, "p cnf %d %d\n", m.aux, len(m.clauses))
+  for _, c := range m.clauses {
+    for _, l := range c {
+      fmt.Fprintf(b, "%d ", l)
+    }
+    b.WriteString("0\n")
+  }
+  return b.Flush()
+}
+
+// errUnknown is returned by solve when the solver gave up without an answer.
+var errUnknown = errors.New("the solver did not decide the miter")
+
+// solve writes m to scratch and runs command on it, returning the model it found and true if
+// the miter is satisfiable, and false if it is unsatisfiable. The answer is taken from the `s`
+// line, or without one from the `v` lines and the exit code, 10 or 20.
+func solve(command []string, scratch string, m *miter) ([]int, bool, error) {
+  file, err := os.Create(scratch)
+  if err != nil {
+    return nil, false, err
+  }
+  err = m.write(file)
+  if cerr := file.Close(); err == nil {
+    err = cerr
+  }
+  if err != nil {
+    return nil, false, err
+  }
+  args := make([]string, 0, len(command))
+  replaced := false
+  for _, a := range command[1:] {
+    if strings.Contains(a, "{}") {
+      replaced = true
+    }
+    args = append(args, strings.ReplaceAll(a, "{}", scratch))
+  }
+  if !replaced {
+    args = append(args, scratch)
+  }
+  cmd := exec.Command(command[0], args...)
+  cmd.Stderr = os.Stderr
+  out, err := cmd.Output()
+  // solvers exit with 10 or 20 to report their answer.
+  var exitErr *exec.ExitError
+  if err != nil && !errors.As(err, &exitErr) {
+    return nil, false, err
+  }
+  code := 0
+  if exitErr != nil {
+    code = exitErr.ExitCode()
+  }
+  var model []int
+  status := ""
+  // hasModel is whether there were literals or a `v` line, which an empty model has.
+  hasModel := false
+  for _, t := range strings.Split(string(out), "\n") {
+    parts := strings.Fields(t)
+    if len(parts) == 0 || parts[0] == "c" {
+      continue
+    }
+    if parts[0] == "s" {
+      status = strings.Join(parts[1:], " ")
+      continue
+    }
+    if parts[0] == "v" {
+      parts = parts[1:]
+    }
+    hasModel = true
+    for _, part := range parts {
+      l, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, false, fmt.Errorf("%s: invalid literal %s", command[0], part)
+      }
+      if l != 0 {
+        model = append(model, l)
+      }
+    }
+  }
+  switch {
+  case status == "UNSATISFIABLE":
+    return nil, false, nil
+  case status == "SATISFIABLE" && hasModel:
+    return model, true, nil
+  case status == "SATISFIABLE":
+    return nil, false, fmt.Errorf("%s reported SATISFIABLE without a model", command[0])
+  case status != "":
+    return nil, false, errUnknown
+  case hasModel:
+    return model, true, nil
+  case code == 20:
+    return nil, false, nil
+  case code == 10:
+    return nil, false, fmt.Errorf("%s exited with 10 for satisfiable without a model", command[0])
+  }
+  return nil, false, fmt.Errorf("%s gave neither a model nor UNSATISFIABLE", command[0])
+}
+
+func load(path string) *formula {
+  file, err := os.Open(path)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  f, err := parse(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", path, err)
+  }
+  return f
+}
+
+func main() {
+  flag.Parse()
+  if *aPath == "" || *bPath == "" {
+    log.Fatalln("Must pass -a and -b")
+  }
+  m := newMiter(load(*aPath), load(*bPath))
+  if flag.NArg() == 0 {
+    if err := m.write(os.Stdout); err != nil {
+      log.Fatalln(err)
+    }
+    return
+  }
+  scratch, err := os.CreateTemp("", "equiv-*.cnf")
+  if err != nil {
+    log.Fatalln(err)
+  }
+  scratch.Close()
+  model, sat, err := solve(flag.Args(), scratch.Name(), m)
+  os.Remove(scratch.Name())
+  if err == errUnknown {
+    fmt.Println("unknown")
+    os.Exit(2)
+  }
+  if err != nil {
+    log.Fatalln(err)
+  }
+  if !sat {
+    fmt.Println("equivalent")
+    return
+  }
+  satisfied, falsified := *bPath, *aPath
+  var lits []string
+  for _, l := range model {
+    if l == m.vars+1 {
+      satisfied, falsified = falsified, satisfied
+    }
+    if abs(l) > m.vars {
+      continue
+    }
+    name, ok := m.names[abs(l)]
+    if !ok {
+      name = strconv.Itoa(abs(l))
+    }
+    if l < 0 {
+      name = "-" + name
+    }
+    lits = append(lits, name)
+  }
+  fmt.Printf("not equivalent, %s holds but %s does not: %s\n", satisfied, falsified, strings.Join(lits, " "))
+  os.Exit(1)
+}
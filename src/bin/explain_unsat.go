@@ -0,0 +1,405 @@
+/*
+A simple binary which decides Horn and 2-SAT formulas, and explains why they are unsatisfiable
+in terms of the input clauses, rather than as a DRAT proof.
+Can be run on a dimacs file by running `explain_unsat -f <FILE>`.
+
+For a Horn formula the explanation is the chain of unit propagations which starting from all
+variables false forces some clause to be violated. For a 2-SAT formula it is the pair of
+implication paths x -> ... -> -x and -x -> ... -> x through the clauses. Satisfiable formulas
+print a model instead. Formulas in neither class are rejected. Variables named by
+`c var <n> <name>` comments are explained by name, though the model is always numeric.
+Clauses are referred to by their number, counting from 1, and the input line they start on, so
+an explanation can be followed in a generated file. An empty clause is explained by itself, and
+a formula without clauses has the empty model. Input ends at a line starting with `%`, so the
+trailing `% 0` of the SATLIB benchmarks is ignored.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "File to explain")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// formula is a parsed input.
+type formula struct {
+  clauses [][]int
+  // lines[i] is the input line clause i starts on, so explanations can point into the file.
+  lines []int
+  // names maps variables to the names given by `c var <n> <name>` comments, which are used in
+  // explanations in place of numbers.
+  names map[int]string
+}
+
+func (f *formula) litString(lit int) string {
+  name, ok := f.names[abs(lit)]
+  if !ok {
+    return strconv.Itoa(lit)
+  }
+  if lit < 0 {
+    return "-" + name
+  }
+  return name
+}
+
+func (f *formula) clauseString(c []int) string {
+  var s = "("
+  for i, lit := range c {
+    if i > 0 {
+      s += ", "
+    }
+    s += f.litString(lit)
+  }
+  s += ")"
+  return s
+}
+
+// clauseRef names clause i by its number, counting from 1, and its line.
+func (f *formula) clauseRef(i int) string {
+  return fmt.Sprintf("clause %d at line %d", i+1, f.lines[i])
+}
+
+// maxLine is the longest line the parser accepts.
+const maxLine = 64 * 1024 * 1024
+
+func parse(r io.Reader) (*formula, error) {
+  f := &formula{names: map[int]string{}}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line, start := 0, 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          f.names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if start == 0 {
+        start = line
+      }
+      if item == 0 {
+        f.clauses = append(f.clauses, curr)
+        f.lines = append(f.lines, start)
+        curr, start = nil, 0
+      } else {
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return f, scanner.Err()
+}
+
+func isHorn(clauses [][]int) bool {
+  for _, c := range clauses {
+    pos := 0
+    for _, l := range c {
+      if l > 0 {
+        pos++
+      }
+    }
+    if pos > 1 {
+      return false
+    }
+  }
+  return true
+}
+
+func is2SAT(clauses [][]int) bool {
+  for _, c := range clauses {
+    if len(c) > 2 {
+      return false
+    }
+  }
+  return true
+}
+
+func printModel(w io.Writer, vars int, value func(v int) bool) {
+  fmt.Fprintln(w, "s SATISFIABLE")
+  fmt.Fprint(w, "v")
+  for v := 1; v <= vars; v++ {
+    if value(v) {
+      fmt.Fprintf(w, " %d", v)
+    } else {
+      fmt.Fprintf(w, " %d", -v)
+    }
+  }
+  fmt.Fprintln(w, " 0")
+}
+
+func numVars(clauses [][]int) int {
+  vars := 0
+  for _, c := range clauses {
+    for _, l := range c {
+      if abs(l) > vars {
+        vars = abs(l)
+      }
+    }
+  }
+  return vars
+}
+
+// explainHorn runs the minimal model computation of a Horn formula. A variable is only set true
+// when a clause forces it, so on a conflict the reasons of the violated clause's variables are
+// exactly the propagations which explain it.
+func explainHorn(w io.Writer, f *formula) {
+  clauses := f.clauses
+  vars := numVars(clauses)
+  value := make([]bool, vars+1)
+  // reason[v] is the clause which forced v true.
+  reason := make([]int, vars+1)
+  // missing[i] is the number of negative literals of clause i whose variable is still false.
+  missing := make([]int, len(clauses))
+  occurs := make([][]int, vars+1)
+  var queue []int
+  conflict := -1
+  for i, c := range clauses {
+    for _, l := range c {
+      if l < 0 {
+        missing[i]++
+        occurs[-l] = append(occurs[-l], i)
+      }
+    }
+    if missing[i] == 0 {
+      queue = append(queue, i)
+    }
+  }
+  for len(queue) > 0 && conflict == -1 {
+    i := queue[0]
+    queue = queue[1:]
+    head := 0
+    for _, l := range clauses[i] {
+      if l > 0 {
+        head = l
+      }
+    }
+    if head == 0 {
+      conflict = i
+      break
+    }
+    if value[head] {
+      continue
+    }
+    value[head] = true
+    reason[head] = i
+    for _, j := range occurs[head] {
+      missing[j]--
+      if missing[j] == 0 {
+        queue = append(queue, j)
+      }
+    }
+  }
+  if conflict == -1 {
+    printModel(w, vars, func(v int) bool { return value[v] })
+    return
+  }
+  fmt.Fprintln(w, "s UNSATISFIABLE")
+  fmt.Fprintln(w, "c the formula is Horn, so every variable is false unless a clause forces it true:")
+  done := make([]bool, vars+1)
+  var explain func(v int)
+  explain = func(v int) {
+    if done[v] {
+      return
+    }
+    done[v] = true
+    r := reason[v]
+    var because []string
+    for _, l := range clauses[r] {
+      if l < 0 {
+        explain(-l)
+        because = append(because, f.litString(-l))
+      }
+    }
+    if len(because) == 0 {
+      fmt.Fprintf(w, "c   %s %s forces %s\n", f.clauseRef(r), f.clauseString(clauses[r]), f.litString(v))
+      return
+    }
+    fmt.Fprintf(w, "c   %s %s forces %s since %s\n", f.clauseRef(r), f.clauseString(clauses[r]), f.litString(v), strings.Join(because, ", "))
+  }
+  for _, l := range clauses[conflict] {
+    explain(-l)
+  }
+  fmt.Fprintf(w, "c   %s %s is then violated\n", f.clauseRef(conflict), f.clauseString(clauses[conflict]))
+}
+
+// implication is an edge of the 2-SAT implication graph, derived from a clause.
+type implication struct {
+  to, clause int
+}
+
+// litIndex maps literals to nodes of the implication graph.
+func litIndex(l int) int {
+  if l > 0 {
+    return 2 * l
+  }
+  return -2*l + 1
+}
+
+func indexLit(i int) int {
+  if i%2 == 0 {
+    return i / 2
+  }
+  return -(i / 2)
+}
+
+// explain2SAT finds the strongly connected components of the implication graph with Tarjan's
+// algorithm. The formula is unsatisfiable exactly when some x and -x are in one component.
+func explain2SAT(w io.Writer, f *formula) {
+  clauses := f.clauses
+  vars := numVars(clauses)
+  n := 2*vars + 2
+  graph := make([][]implication, n)
+  for i, c := range clauses {
+    switch len(c) {
+    case 0:
+      fmt.Fprintln(w, "s UNSATISFIABLE")
+      fmt.Fprintf(w, "c %s is empty\n", f.clauseRef(i))
+      return
+    case 1:
+      graph[litIndex(-c[0])] = append(graph[litIndex(-c[0])], implication{litIndex(c[0]), i})
+    case 2:
+      graph[litIndex(-c[0])] = append(graph[litIndex(-c[0])], implication{litIndex(c[1]), i})
+      graph[litIndex(-c[1])] = append(graph[litIndex(-c[1])], implication{litIndex(c[0]), i})
+    }
+  }
+  index := make([]int, n)
+  low := make([]int, n)
+  onStack := make([]bool, n)
+  comp := make([]int, n)
+  for i := range index {
+    index[i] = -1
+  }
+  var stack []int
+  next, comps := 0, 0
+  var strongConnect func(v int)
+  strongConnect = func(v int) {
+    index[v], low[v] = next, next
+    next++
+    stack = append(stack, v)
+    onStack[v] = true
+    for _, e := range graph[v] {
+      if index[e.to] == -1 {
+        strongConnect(e.to)
+        low[v] = min(low[v], low[e.to])
+      } else if onStack[e.to] {
+        low[v] = min(low[v], index[e.to])
+      }
+    }
+    if low[v] == index[v] {
+      for {
+        u := stack[len(stack)-1]
+        stack = stack[:len(stack)-1]
+        onStack[u] = false
+        comp[u] = comps
+        if u == v {
+          break
+        }
+      }
+      comps++
+    }
+  }
+  for v := 2; v < n; v++ {
+    if index[v] == -1 {
+      strongConnect(v)
+    }
+  }
+  for v := 1; v <= vars; v++ {
+    if comp[litIndex(v)] != comp[litIndex(-v)] {
+      continue
+    }
+    fmt.Fprintln(w, "s UNSATISFIABLE")
+    fmt.Fprintf(w, "c the formula is 2-SAT, and %s and %s imply each other:\n", f.litString(v), f.litString(-v))
+    writePath(w, f, graph, litIndex(v), litIndex(-v))
+    writePath(w, f, graph, litIndex(-v), litIndex(v))
+    return
+  }
+  // Tarjan numbers components in reverse topological order, so a literal is true when its
+  // component comes before its negation's.
+  printModel(w, vars, func(v int) bool { return comp[litIndex(v)] < comp[litIndex(-v)] })
+}
+
+// writePath writes a shortest implication path from a to b.
+func writePath(w io.Writer, f *formula, graph [][]implication, a, b int) {
+  prev := make([]implication, len(graph))
+  seen := make([]bool, len(graph))
+  seen[a] = true
+  queue := []int{a}
+  for len(queue) > 0 && !seen[b] {
+    v := queue[0]
+    queue = queue[1:]
+    for _, e := range graph[v] {
+      if !seen[e.to] {
+        seen[e.to] = true
+        prev[e.to] = implication{v, e.clause}
+        queue = append(queue, e.to)
+      }
+    }
+  }
+  var steps []string
+  for v := b; v != a; v = prev[v].to {
+    p := prev[v]
+    steps = append(steps, fmt.Sprintf("c   %s implies %s by %s %s", f.litString(indexLit(p.to)), f.litString(indexLit(v)), f.clauseRef(p.clause), f.clauseString(f.clauses[p.clause])))
+  }
+  for i := len(steps) - 1; i >= 0; i-- {
+    fmt.Fprintln(w, steps[i])
+  }
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  f, err := parse(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  out := bufio.NewWriter(os.Stdout)
+  defer out.Flush()
+  switch {
+  case is2SAT(f.clauses):
+    explain2SAT(out, f)
+  case isHorn(f.clauses):
+    explainHorn(out, f)
+  default:
+    log.Fatalln("Formula is neither Horn nor 2-SAT")
+  }
+}
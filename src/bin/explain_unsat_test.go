@@ -0,0 +1,19 @@
+package main
+
+// Run with `go test explain_unsat.go explain_unsat_test.go`.
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestParseUnterminated(t *testing.T) {
+  _, err := parse(strings.NewReader("p cnf 1 2\n1 0\n-1"))
+  if err == nil || err.Error() != "line 3: last clause is not terminated by 0" {
+    t.Fatalf("parsing a formula whose last clause has no 0 gave error %v", err)
+  }
+  f, err := parse(strings.NewReader("p cnf 1 2\n1 0\n-1 0\n%\n0\n"))
+  if err != nil || len(f.clauses) != 2 {
+    t.Fatalf("parsing a terminated formula gave %v and error %v", f, err)
+  }
+}
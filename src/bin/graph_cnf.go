@@ -0,0 +1,452 @@
+/*
+A simple binary which turns a graph back into a CNF, the reverse of clause_graph. The graph is
+read from a graphviz file, or from JSON of the form
+`{"nodes": [{"id": "a", "charge": 1}, ...], "edges": [{"source": "a", "target": "b"}, ...]}`
+(nodes may also be plain ids, and edges `["a", "b"]` pairs).
+Can be run by `graph_cnf -f <GRAPH> > out.cnf`.
+
+The output is the Tseitin formula of the graph: each edge is a variable, and each node requires
+the xor of its edges to equal its charge. The formula is unsatisfiable exactly when some
+connected component has an odd total charge. Charges are taken from `charge` attributes, and if
+no node has one the first node is charged (`-charge first`), which gives its component an odd
+charge, so the formula is always unsatisfiable, the hard case for resolution on expanders.
+Xors of more than `-cut` edges are split with auxiliary variables. Edges are named by `c var`
+comments and each node's clauses are preceded by a comment, so `clause_graph -cluster-comments`
+on the output groups clauses by node again.
+*/
+package main
+
+import (
+  "bufio"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "path/filepath"
+  "strings"
+  "unicode"
+)
+
+var filePath = flag.String("f", "", "Graph file to encode")
+var inFormat = flag.String("format", "", "dot|json, by default json for .json files and dot otherwise")
+var chargeMode = flag.String("charge", "first", "Charges when no node has a charge attribute: first|none")
+var cut = flag.Int("cut", 4, "Largest xor encoded directly, larger ones are split with auxiliary variables")
+
+type graphNode struct {
+  id     string
+  charge int
+  // charged is whether the charge was given by an attribute.
+  charged bool
+}
+
+type graph struct {
+  nodes []graphNode
+  index map[string]int
+  edges [][2]int
+}
+
+func newGraph() *graph {
+  return &graph{index: map[string]int{}}
+}
+
+// node returns the index of the node with this id, adding it if it is new.
+func (g *graph) node(id string) int {
+  if i, ok := g.index[id]; ok {
+    return i
+  }
+  g.index[id] = len(g.nodes)
+  g.nodes = append(g.nodes, graphNode{id: id})
+  return len(g.nodes) - 1
+}
+
+func (g *graph) setCharge(i int, value string) error {
+  var c int
+  if _, err := fmt.Sscan(value, &c); err != nil {
+    return fmt.Errorf("node %s: invalid charge %q", g.nodes[i].id, value)
+  }
+  g.nodes[i].charge = c & 1
+  g.nodes[i].charged = true
+  return nil
+}
+
+// dotToken is a token of a graphviz file, where ids are kept unquoted.
+type dotToken struct {
+  text string
+  id   bool
+  line int
+}
+
+func tokenizeDot(src string) ([]dotToken, error) {
+  var toks []dotToken
+  line := 1
+  for i := 0; i < len(src); {
+    c := rune(src[i])
+    switch {
+    case c == '\n':
+      line++
+      i++
+    case unicode.IsSpace(c):
+      i++
+    case strings.HasPrefix(src[i:], "//") || c == '#':
+      for i < len(src) && src[i] != '\n' {
+        i++
+      }
+    case strings.HasPrefix(src[i:], "/*"):
+      end := strings.Index(src[i+2:], "*/")
+      if end == -1 {
+        return nil, fmt.Errorf("line %d: unterminated comment", line)
+      }
+      line += strings.Count(src[i:i+2+end], "\n")
+      i += end + 4
+    case c == '"':
+      var sb strings.Builder
+      start := line
+      i++
+      for ; i < len(src) && src[i] != '"'; i++ {
+        if src[i] == '\\' && i+1 < len(src) && src[i+1] == '"' {
+          i++
+        }
+        if src[i] == '\n' {
+          line++
+        }
+        sb.WriteByte(src[i])
+      }
+      if i == len(src) {
+        return nil, fmt.Errorf("line %d: unterminated string", start)
+      }
+      i++
+      toks = append(toks, dotToken{sb.String(), true, start})
+    case strings.HasPrefix(src[i:], "--") || strings.HasPrefix(src[i:], "->"):
+      toks = append(toks, dotToken{src[i : i+2], false, line})
+      i += 2
+    case strings.ContainsRune("{}[];,=:", c):
+      toks = append(toks, dotToken{string(c), false, line})
+      i++
+    case c == '_' || c == '.' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c) || c >= 0x80:
+      j := i
+      if c == '-' {
+        j++
+      }
+      for j < len(src) {
+        d := rune(src[j])
+        if d != '_' && d != '.' && !unicode.IsLetter(d) && !unicode.IsDigit(d) && d < 0x80 {
+          break
+        }
+        j++
+      }
+      toks = append(toks, dotToken{src[i:j], true, line})
+      i = j
+    default:
+      return nil, fmt.Errorf("line %d: unexpected %q", line, c)
+    }
+  }
+  return toks, nil
+}
+
+// parseDot reads the nodes and edges of a graphviz graph. Subgraphs are flattened, and default
+// attribute statements are ignored.
+func parseDot(r io.Reader) (*graph, error) {
+  src, err := io.ReadAll(r)
+  if err != nil {
+    return nil, err
+  }
+  toks, err := tokenizeDot(string(src))
+  if err != nil {
+    return nil, err
+  }
+  g := newGraph()
+  pos := 0
+  peek := func(text string) bool {
+    return pos < len(toks) && !toks[pos].id && toks[pos].text == text
+  }
+  fail := func(msg string) error {
+    if pos < len(toks) {
+      return fmt.Errorf("line %d: %s", toks[pos].line, msg)
+    }
+    return fmt.Errorf("end of file: %s", msg)
+  }
+  // attrs reads a bracketed attribute list into a map.
+  attrs := func() (map[string]string, error) {
+    out := map[string]string{}
+    for peek("[") {
+      pos++
+      for !peek("]") {
+        if pos+2 >= len(toks) || !toks[pos].id || toks[pos+1].text != "=" || !toks[pos+2].id {
+          return nil, fail("expected key=value")
+        }
+        out[toks[pos].text] = toks[pos+2].text
+        pos += 3
+        if peek(",") || peek(";") {
+          pos++
+        }
+      }
+      pos++
+    }
+    return out, nil
+  }
+  for pos < len(toks) && toks[pos].id && (toks[pos].text == "strict" || toks[pos].text == "graph" || toks[pos].text == "digraph") {
+    pos++
+  }
+  if pos < len(toks) && toks[pos].id {
+    pos++
+  }
+  if !peek("{") {
+    return nil, fail("expected {")
+  }
+  pos++
+  depth := 1
+  for depth > 0 {
+    switch {
+    case pos == len(toks):
+      return nil, fail("expected }")
+    case peek("}"):
+      depth--
+      pos++
+    case peek("{"):
+      depth++
+      pos++
+    case peek(";") || peek(","):
+      pos++
+    case !toks[pos].id:
+      return nil, fail(fmt.Sprintf("unexpected %q", toks[pos].text))
+    case toks[pos].text == "subgraph":
+      pos++
+      if pos < len(toks) && toks[pos].id {
+        pos++
+      }
+    case toks[pos].text == "node" || toks[pos].text == "edge" || toks[pos].text == "graph":
+      pos++
+      if _, err := attrs(); err != nil {
+        return nil, err
+      }
+    case pos+1 < len(toks) && toks[pos+1].text == "=":
+      pos += 3
+    default:
+      ids := []int{g.node(toks[pos].text)}
+      pos++
+      for peek("--") || peek("->") {
+        pos++
+        if pos == len(toks) || !toks[pos].id {
+          return nil, fail("expected node id")
+        }
+        ids = append(ids, g.node(toks[pos].text))
+        pos++
+      }
+      a, err := attrs()
+      if err != nil {
+        return nil, err
+      }
+      if len(ids) == 1 {
+        if c, ok := a["charge"]; ok {
+          if err := g.setCharge(ids[0], c); err != nil {
+            return nil, err
+          }
+        }
+        continue
+      }
+      for i := 1; i < len(ids); i++ {
+        g.edges = append(g.edges, [2]int{ids[i-1], ids[i]})
+      }
+    }
+  }
+  return g, nil
+}
+
+// jsonID accepts both string and numeric node ids.
+func jsonID(raw json.RawMessage) (string, error) {
+  var s string
+  if err := json.Unmarshal(raw, &s); err == nil {
+    return s, nil
+  }
+  var n json.Number
+  if err := json.Unmarshal(raw, &n); err != nil {
+    return "", fmt.Errorf("invalid node id %s", raw)
+  }
+  return n.String(), nil
+}
+
+func parseJSON(r io.Reader) (*graph, error) {
+  var doc struct {
+    Nodes []json.RawMessage `json:"nodes"`
+    Edges []json.RawMessage `json:"edges"`
+  }
+  if err := json.NewDecoder(r).Decode(&doc); err != nil {
+    return nil, err
+  }
+  g := newGraph()
+  for _, raw := range doc.Nodes {
+    var n struct {
+      ID     json.RawMessage `json:"id"`
+      Charge *json.Number    `json:"charge"`
+    }
+    if err := json.Unmarshal(raw, &n); err != nil || n.ID == nil {
+      n.ID = raw
+    }
+    id, err := jsonID(n.ID)
+    if err != nil {
+      return nil, err
+    }
+    i := g.node(id)
+    if n.Charge != nil {
+      if err := g.setCharge(i, n.Charge.String()); err != nil {
+        return nil, err
+      }
+    }
+  }
+  for _, raw := range doc.Edges {
+    var pair []json.RawMessage
+    if err := json.Unmarshal(raw, &pair); err != nil {
+      var e struct {
+        Source json.RawMessage `json:"source"`
+        Target json.RawMessage `json:"target"`
+      }
+      if err := json.Unmarshal(raw, &e); err != nil || e.Source == nil || e.Target == nil {
+        return nil, fmt.Errorf("invalid edge %s", raw)
+      }
+      pair = []json.RawMessage{e.Source, e.Target}
+    }
+    if len(pair) != 2 {
+      return nil, fmt.Errorf("invalid edge %s", raw)
+    }
+    a, err := jsonID(pair[0])
+    if err != nil {
+      return nil, err
+    }
+    b, err := jsonID(pair[1])
+    if err != nil {
+      return nil, err
+    }
+    g.edges = append(g.edges, [2]int{g.node(a), g.node(b)})
+  }
+  return g, nil
+}
+
+// xorClauses appends the clauses which require the xor of lits to equal parity, one clause
+// forbidding each assignment of the wrong parity.
+func xorClauses(clauses [][]int, lits []int, parity int) [][]int {
+  for a := 0; a < 1<<len(lits); a++ {
+    ones := 0
+    for i := range lits {
+      ones += a >> i & 1
+    }
+    if ones&1 == parity {
+      continue
+    }
+    c := make([]int, len(lits))
+    for i, l := range lits {
+      if a>>i&1 == 1 {
+        c[i] = -l
+      } else {
+        c[i] = l
+      }
+    }
+    clauses = append(clauses, c)
+  }
+  return clauses
+}
+
+// encode writes the Tseitin formula of g as DIMACS.
+func encode(w io.Writer, g *graph) error {
+  charged := false
+  for _, n := range g.nodes {
+    charged = charged || n.charged
+  }
+  if !charged && len(g.nodes) > 0 {
+    switch *chargeMode {
+    case "first":
+      g.nodes[0].charge = 1
+    case "none":
+    default:
+      return fmt.Errorf("unknown charge mode %q", *chargeMode)
+    }
+  }
+  if *cut < 3 {
+    return fmt.Errorf("-cut must be at least 3, got %d", *cut)
+  }
+  incident := make([][]int, len(g.nodes))
+  for i, e := range g.edges {
+    // A self loop adds its variable to the xor twice, so it cancels out.
+    if e[0] == e[1] {
+      continue
+    }
+    incident[e[0]] = append(incident[e[0]], i+1)
+    incident[e[1]] = append(incident[e[1]], i+1)
+  }
+  vars := len(g.edges)
+  blocks := make([][][]int, len(g.nodes))
+  numClauses := 0
+  for i, n := range g.nodes {
+    lits := incident[i]
+    var clauses [][]int
+    for len(lits) > *cut {
+      vars++
+      head := append(append([]int{}, lits[:*cut-1]...), vars)
+      clauses = xorClauses(clauses, head, 0)
+      lits = append([]int{vars}, lits[*cut-1:]...)
+    }
+    blocks[i] = xorClauses(clauses, lits, n.charge)
+    numClauses += len(blocks[i])
+  }
+  out := bufio.NewWriter(w)
+  fmt.Fprintf(out, "c Tseitin formula of a graph with %d nodes and %d edges\n", len(g.nodes), len(g.edges))
+  for i, e := range g.edges {
+    fmt.Fprintf(out, "c var %d %s\n", i+1, varName(g.nodes[e[0]].id+"_"+g.nodes[e[1]].id))
+  }
+  fmt.Fprintf(out, "p cnf %d %d\n", vars, numClauses)
+  for i, n := range g.nodes {
+    fmt.Fprintf(out, "c node %s charge %d\n", n.id, n.charge)
+    for _, c := range blocks[i] {
+      for _, l := range c {
+        fmt.Fprintf(out, "%d ", l)
+      }
+      fmt.Fprintln(out, "0")
+    }
+  }
+  return out.Flush()
+}
+
+// varName makes a name fit in a single field of a `c var` comment.
+func varName(s string) string {
+  return strings.Map(func(r rune) rune {
+    if unicode.IsSpace(r) {
+      return '_'
+    }
+    return r
+  }, s)
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  format := *inFormat
+  if format == "" {
+    format = "dot"
+    if strings.EqualFold(filepath.Ext(*filePath), ".json") {
+      format = "json"
+    }
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  var g *graph
+  switch format {
+  case "dot":
+    g, err = parseDot(file)
+  case "json":
+    g, err = parseJSON(file)
+  default:
+    err = fmt.Errorf("unknown format %q", format)
+  }
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  if err := encode(os.Stdout, g); err != nil {
+    log.Fatalln(err)
+  }
+}
@@ -0,0 +1,375 @@
+/*
+A simple binary which writes the negation or the dual of a dimacs file as dimacs, for checking
+validity and for counterexample guided loops.
+Can be run by `negate -f <FILE> > out.cnf`.
+
+The negation of a CNF is a DNF, with one cube of negated literals per clause, so it is
+re-encoded with one auxiliary variable per clause which implies its cube, and a clause
+requiring one of them. The models of the result are exactly the assignments falsifying the
+input, extended to the auxiliaries, so the input is valid iff the result is unsatisfiable.
+With `-dual` the cubes keep the clause's literals instead, which encodes the dual formula,
+the input with conjunctions and disjunctions swapped. With `-define` each auxiliary is also
+implied by its cube, so it is true exactly when its clause is falsified (or, for the dual,
+when all the clause's literals hold), and the extension to the auxiliaries is unique.
+
+Auxiliary variables are numbered after the input's variables, and named `clause<i>` for the
+i-th clause by a `c var` comment unless that name is taken.
+
+`-negate-and-solve <QUERY>` instead checks whether the input implies a query in DNF, by
+conjoining the input with the negated query and running a solver command given after `--` on
+it, as in `negate -f <FILE> -negate-and-solve query.txt -- kissat`. Each line of the query is a
+cube of literals, by number or by `c var` name with a `-` for negation, so the negated query is a
+clause per cube and needs no auxiliaries. `{}` in the command's arguments is replaced by the
+path of the CNF, which is appended if there is no `{}`, and the command must write its answer to
+stdout in the competition format. If the query is not implied, the assignment to the input's
+variables found by the solver is printed as a countermodel, and the exit code is 1. The query
+is only reported implied when the solver answers UNSATISFIABLE, or exits with 20 without an
+`s` line. If it answers anything else without a model, such as UNKNOWN after a timeout,
+`unknown` is printed and the exit code is 2.
+*/
+package main
+
+import (
+  "bufio"
+  "errors"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "os/exec"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "File to negate")
+var dual = flag.Bool("dual", false, "Write the dual formula instead of the negation")
+var define = flag.Bool("define", false, "Also define each auxiliary variable as equivalent to its cube")
+var query = flag.String("negate-and-solve", "", "Check whether the input implies the DNF query in this file with the solver command after --")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// formula is a parsed input, vars is the larger of the header's variable count and the largest
+// variable used.
+type formula struct {
+  vars    int
+  clauses [][]int
+  names   map[int]string
+}
+
+// maxLine is the longest line the formula and query parsers accept.
+const maxLine = 64 * 1024 * 1024
+
+func parse(r io.Reader) (*formula, error) {
+  f := &formula{names: map[int]string{}}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          f.names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      parts := strings.Fields(t)
+      if len(parts) == 4 {
+        if v, err := strconv.Atoi(parts[2]); err == nil {
+          f.vars = max(f.vars, v)
+        }
+      }
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        f.clauses = append(f.clauses, curr)
+        curr = nil
+      } else {
+        f.vars = max(f.vars, abs(item))
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return f, scanner.Err()
+}
+
+// negation returns the clauses encoding the negation, or with dual the dual, of f, using
+// auxiliary variables f.vars+1 onwards.
+func negation(f *formula, dual, define bool) [][]int {
+  var out [][]int
+  some := make([]int, len(f.clauses))
+  for i, c := range f.clauses {
+    aux := f.vars + i + 1
+    some[i] = aux
+    // cube holds the literals which are all true when aux is.
+    cube := make([]int, len(c))
+    for j, l := range c {
+      cube[j] = -l
+      if dual {
+        cube[j] = l
+      }
+      out = append(out, []int{-aux, cube[j]})
+    }
+    if define {
+      def := []int{aux}
+      for _, l := range cube {
+        def = append(def, -l)
+      }
+      out = append(out, def)
+    }
+  }
+  return append(out, some)
+}
+
+func write(w io.Writer, f *formula, clauses [][]int) error {
+  b := bufio.NewWriter(w)
+  names := map[int]string{}
+  taken := map[string]bool{}
+  for v, name := range f.names {
+    names[v] = name
+    taken[name] = true
+  }
+  for i := range f.clauses {
+    if name := "clause" + strconv.Itoa(i+1); !taken[name] {
+      names[f.vars+i+1] = name
+    }
+  }
+  vars := make([]int, 0, len(names))
+  for v := range names {
+    vars = append(vars, v)
+  }
+  sort.Ints(vars)
+  for _, v := range vars {
+    fmt.Fprintf(b, "c var %d %s\n", v, names[v])
+  }
+  fmt.Fprintf(b, "p cnf %d %d\n", f.vars+len(f.clauses), len(clauses))
+  for _, c := range clauses {
+    for _, l := range c {
+      fmt.Fprintf(b, "%d ", l)
+    }
+    b.WriteString("0\n")
+  }
+  return b.Flush()
+}
+
+// parseQuery reads a DNF query, a cube of literals per line, where literals are numbers or the
+// names of f's variables, and returns the clauses of its negation.
+func parseQuery(r io.Reader, f *formula) ([][]int, error) {
+  byName := map[string]int{}
+  for v, name := range f.names {
+    byName[name] = v
+  }
+  var negated [][]int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    parts := strings.Fields(scanner.Text())
+    if len(parts) == 0 || parts[0] == "c" {
+      continue
+    }
+    var clause []int
+    for _, part := range parts {
+      neg := strings.HasPrefix(part, "-")
+      name := strings.TrimPrefix(part, "-")
+      v, ok := byName[name]
+      if !ok {
+        n, err := strconv.Atoi(name)
+        if err != nil || n <= 0 {
+          return nil, fmt.Errorf("line %d: unknown variable %s", line, name)
+        }
+        v = n
+      }
+      if v > f.vars {
+        return nil, fmt.Errorf("line %d: variable %s does not occur in the input", line, name)
+      }
+      // the negation of the cube holds the negation of each literal.
+      if neg {
+        clause = append(clause, v)
+      } else {
+        clause = append(clause, -v)
+      }
+    }
+    negated = append(negated, clause)
+  }
+  return negated, scanner.Err()
+}
+
+// errUnknown is returned by solve when the solver gave up without an answer.
+var errUnknown = errors.New("the solver did not decide the query")
+
+// solve writes clauses to scratch and runs command on it, returning the model it found and true
+// if the clauses are satisfiable, and false if they are unsatisfiable. The answer is taken from
+// the `s` line, or without one from the `v` lines and the exit code, 10 or 20.
+func solve(command []string, scratch string, f *formula, clauses [][]int) ([]int, bool, error) {
+  file, err := os.Create(scratch)
+  if err != nil {
+    return nil, false, err
+  }
+  err = write(file, &formula{vars: f.vars, names: f.names}, clauses)
+  if cerr := file.Close(); err == nil {
+    err = cerr
+  }
+  if err != nil {
+    return nil, false, err
+  }
+  args := make([]string, 0, len(command))
+  replaced := false
+  for _, a := range command[1:] {
+    if strings.Contains(a, "{}") {
+      replaced = true
+    }
+    args = append(args, strings.ReplaceAll(a, "{}", scratch))
+  }
+  if !replaced {
+    args = append(args, scratch)
+  }
+  cmd := exec.Command(command[0], args...)
+  cmd.Stderr = os.Stderr
+  out, err := cmd.Output()
+  // solvers exit with 10 or 20 to report their answer.
+  var exitErr *exec.ExitError
+  if err != nil && !errors.As(err, &exitErr) {
+    return nil, false, err
+  }
+  code := 0
+  if exitErr != nil {
+    code = exitErr.ExitCode()
+  }
+  var model []int
+  status := ""
+  // hasModel is whether there were literals or a `v` line, which an empty model has.
+  hasModel := false
+  for _, t := range strings.Split(string(out), "\n") {
+    parts := strings.Fields(t)
+    if len(parts) == 0 || parts[0] == "c" {
+      continue
+    }
+    if parts[0] == "s" {
+      status = strings.Join(parts[1:], " ")
+      continue
+    }
+    if parts[0] == "v" {
+      parts = parts[1:]
+    }
+    hasModel = true
+    for _, part := range parts {
+      l, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, false, fmt.Errorf("%s: invalid literal %s", command[0], part)
+      }
+      if l != 0 {
+        model = append(model, l)
+      }
+    }
+  }
+  switch {
+  case status == "UNSATISFIABLE":
+    return nil, false, nil
+  case status == "SATISFIABLE" && hasModel:
+    return model, true, nil
+  case status == "SATISFIABLE":
+    return nil, false, fmt.Errorf("%s reported SATISFIABLE without a model", command[0])
+  case status != "":
+    return nil, false, errUnknown
+  case hasModel:
+    return model, true, nil
+  case code == 20:
+    return nil, false, nil
+  case code == 10:
+    return nil, false, fmt.Errorf("%s exited with 10 for satisfiable without a model", command[0])
+  }
+  return nil, false, fmt.Errorf("%s gave neither a model nor UNSATISFIABLE", command[0])
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  f, err := parse(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  if *query == "" {
+    if err := write(os.Stdout, f, negation(f, *dual, *define)); err != nil {
+      log.Fatalln(err)
+    }
+    return
+  }
+  if flag.NArg() == 0 {
+    log.Fatalln("-negate-and-solve requires a solver command after --")
+  }
+  qfile, err := os.Open(*query)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  negated, err := parseQuery(qfile, f)
+  qfile.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *query, err)
+  }
+  scratch, err := os.CreateTemp("", "negate-*.cnf")
+  if err != nil {
+    log.Fatalln(err)
+  }
+  scratch.Close()
+  model, sat, err := solve(flag.Args(), scratch.Name(), f, append(append([][]int{}, f.clauses...), negated...))
+  os.Remove(scratch.Name())
+  if err == errUnknown {
+    fmt.Println("unknown")
+    os.Exit(2)
+  }
+  if err != nil {
+    log.Fatalln(err)
+  }
+  if !sat {
+    fmt.Println("implied")
+    return
+  }
+  var lits []string
+  for _, l := range model {
+    if abs(l) > f.vars {
+      continue
+    }
+    name, ok := f.names[abs(l)]
+    if !ok {
+      name = strconv.Itoa(abs(l))
+    }
+    if l < 0 {
+      name = "-" + name
+    }
+    lits = append(lits, name)
+  }
+  fmt.Printf("not implied, countermodel: %s\n", strings.Join(lits, " "))
+  os.Exit(1)
+}
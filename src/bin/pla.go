@@ -0,0 +1,359 @@
+/*
+A simple binary which converts between dimacs and the PLA format read by espresso, and can
+minimize the formula as a two-level circuit on the way.
+Can be run by `pla -f <FILE>`, which writes a .pla input as dimacs and anything else as PLA to
+stdout, or to the format given by `-to`.
+
+A PLA has a single output, and describes the complement of the formula: each cube is the set of
+assignments one clause forbids, so the clause (1 -2) becomes the cube `01-` and the two can be
+converted back and forth, and the PLA can be minimized by espresso and read back in. Variable
+names from `c var <n> <name>` comments become `.ilb` input labels and back.
+
+`-minimize` repeatedly removes subsumed clauses and applies self-subsuming resolution, which
+includes merging two clauses that differ in the polarity of a single literal, until neither
+applies. This keeps the formula equivalent, and is quadratic in the number of clauses, so it is
+meant for small truth table like formulas.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "Dimacs or .pla file to convert")
+var to = flag.String("to", "", "Output format: cnf|pla, by default the other one than the input's")
+var minimize = flag.Bool("minimize", false, "Minimize the clauses before writing them")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// table is a formula as clauses over vars variables, which may be named.
+type table struct {
+  vars    int
+  clauses [][]int
+  names   map[int]string
+}
+
+func parseCNF(r io.Reader) (*table, error) {
+  t := &table{names: map[int]string{}}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  line := 0
+  for scanner.Scan() {
+    line++
+    text := scanner.Text()
+    if strings.HasPrefix(text, "%") {
+      break
+    }
+    if strings.HasPrefix(text, "c") {
+      parts := strings.Fields(text[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          t.names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(text, "p") {
+      parts := strings.Fields(text)
+      if len(parts) == 4 {
+        if v, err := strconv.Atoi(parts[2]); err == nil {
+          t.vars = max(t.vars, v)
+        }
+      }
+      continue
+    }
+    for _, part := range strings.Fields(text) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        t.clauses = append(t.clauses, curr)
+        curr = nil
+      } else {
+        t.vars = max(t.vars, abs(item))
+        curr = append(curr, item)
+      }
+    }
+  }
+  return t, scanner.Err()
+}
+
+// parsePLA reads the cubes of a single output PLA whose output is 1, each of which becomes the
+// clause forbidding it. Cubes with other outputs are ignored, as for espresso's default type f.
+func parsePLA(r io.Reader) (*table, error) {
+  t := &table{vars: -1, names: map[int]string{}}
+  scanner := bufio.NewScanner(r)
+  line := 0
+  for scanner.Scan() {
+    line++
+    text := strings.TrimSpace(scanner.Text())
+    if i := strings.Index(text, "#"); i != -1 {
+      text = strings.TrimSpace(text[:i])
+    }
+    parts := strings.Fields(text)
+    if len(parts) == 0 {
+      continue
+    }
+    if strings.HasPrefix(parts[0], ".") {
+      switch parts[0] {
+      case ".i":
+        if len(parts) != 2 {
+          return nil, fmt.Errorf("line %d: expected .i <inputs>", line)
+        }
+        n, err := strconv.Atoi(parts[1])
+        if err != nil || n < 0 {
+          return nil, fmt.Errorf("line %d: invalid input count %s", line, parts[1])
+        }
+        t.vars = n
+      case ".o":
+        if len(parts) != 2 || parts[1] != "1" {
+          return nil, fmt.Errorf("line %d: only PLAs with a single output are supported", line)
+        }
+      case ".ilb":
+        for i, name := range parts[1:] {
+          t.names[i+1] = name
+        }
+      case ".type":
+        if len(parts) != 2 || parts[1] != "f" {
+          return nil, fmt.Errorf("line %d: only .type f is supported", line)
+        }
+      case ".e", ".end":
+        return t, nil
+      }
+      continue
+    }
+    if t.vars == -1 {
+      return nil, fmt.Errorf("line %d: cube before .i", line)
+    }
+    // the input and output planes may be written without a space between them.
+    cube := strings.Join(parts, "")
+    if len(cube) != t.vars+1 {
+      return nil, fmt.Errorf("line %d: expected %d inputs and 1 output", line, t.vars)
+    }
+    if cube[t.vars] != '1' {
+      continue
+    }
+    var clause []int
+    for i, c := range cube[:t.vars] {
+      switch c {
+      case '0':
+        clause = append(clause, i+1)
+      case '1':
+        clause = append(clause, -(i + 1))
+      case '-', '2', '~':
+      default:
+        return nil, fmt.Errorf("line %d: invalid input %q", line, c)
+      }
+    }
+    t.clauses = append(t.clauses, clause)
+  }
+  if t.vars == -1 {
+    t.vars = 0
+  }
+  return t, scanner.Err()
+}
+
+func (t *table) name(v int) string {
+  if name, ok := t.names[v]; ok {
+    return name
+  }
+  return "x" + strconv.Itoa(v)
+}
+
+// cubeOf returns the cube of assignments clause c forbids. A tautology forbids nothing, so it
+// has no cube.
+func cubeOf(c []int, vars int) (string, bool) {
+  cube := []byte(strings.Repeat("-", vars))
+  for _, l := range c {
+    v, value := abs(l)-1, byte('0')
+    if l < 0 {
+      value = '1'
+    }
+    if cube[v] != '-' && cube[v] != value {
+      return "", false
+    }
+    cube[v] = value
+  }
+  return string(cube), true
+}
+
+func writePLA(w io.Writer, t *table) error {
+  b := bufio.NewWriter(w)
+  fmt.Fprintf(b, ".i %d\n.o 1\n", t.vars)
+  if len(t.names) > 0 {
+    b.WriteString(".ilb")
+    for v := 1; v <= t.vars; v++ {
+      b.WriteString(" " + t.name(v))
+    }
+    b.WriteString("\n")
+  }
+  var cubes []string
+  for _, c := range t.clauses {
+    if cube, ok := cubeOf(c, t.vars); ok {
+      cubes = append(cubes, cube)
+    }
+  }
+  fmt.Fprintf(b, ".p %d\n", len(cubes))
+  for _, cube := range cubes {
+    fmt.Fprintf(b, "%s 1\n", cube)
+  }
+  b.WriteString(".e\n")
+  return b.Flush()
+}
+
+func writeCNF(w io.Writer, t *table) error {
+  b := bufio.NewWriter(w)
+  vars := make([]int, 0, len(t.names))
+  for v := range t.names {
+    vars = append(vars, v)
+  }
+  sort.Ints(vars)
+  for _, v := range vars {
+    fmt.Fprintf(b, "c var %d %s\n", v, t.names[v])
+  }
+  fmt.Fprintf(b, "p cnf %d %d\n", t.vars, len(t.clauses))
+  for _, c := range t.clauses {
+    for _, l := range c {
+      fmt.Fprintf(b, "%d ", l)
+    }
+    b.WriteString("0\n")
+  }
+  return b.Flush()
+}
+
+// contains reports whether sorted clause a contains every literal of sorted clause b, ignoring
+// the literal skip.
+func contains(a, b []int, skip int) bool {
+  i := 0
+  for _, l := range b {
+    if l == skip {
+      continue
+    }
+    for i < len(a) && a[i] < l {
+      i++
+    }
+    if i == len(a) || a[i] != l {
+      return false
+    }
+  }
+  return true
+}
+
+func has(c []int, l int) bool {
+  i := sort.SearchInts(c, l)
+  return i < len(c) && c[i] == l
+}
+
+// minimizeClauses removes subsumed clauses and strengthens clauses by self-subsuming
+// resolution: if a is b's literals less -l plus l, then the resolvent of a and b subsumes b, so
+// -l can be removed from b. When a and b have the same length this merges them.
+func minimizeClauses(clauses [][]int) [][]int {
+  var out [][]int
+  for _, c := range clauses {
+    c = append([]int{}, c...)
+    sort.Ints(c)
+    tautology := false
+    for _, l := range c {
+      tautology = tautology || (l > 0 && has(c, -l))
+    }
+    if !tautology {
+      out = append(out, c)
+    }
+  }
+  for changed := true; changed; {
+    changed = false
+    sort.SliceStable(out, func(i, j int) bool { return len(out[i]) < len(out[j]) })
+    removed := make([]bool, len(out))
+    for i, a := range out {
+      if removed[i] {
+        continue
+      }
+      for j, b := range out {
+        if i == j || removed[j] || len(b) < len(a) {
+          continue
+        }
+        if contains(b, a, 0) {
+          removed[j] = true
+          changed = true
+          continue
+        }
+        for _, l := range a {
+          if has(b, -l) && contains(b, a, l) {
+            k := sort.SearchInts(b, -l)
+            out[j] = append(append([]int{}, b[:k]...), b[k+1:]...)
+            changed = true
+            break
+          }
+        }
+      }
+    }
+    kept := out[:0]
+    for i, c := range out {
+      if !removed[i] {
+        kept = append(kept, c)
+      }
+    }
+    out = kept
+  }
+  return out
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  isPLA := strings.EqualFold(filepath.Ext(*filePath), ".pla")
+  format := *to
+  if format == "" {
+    format = "pla"
+    if isPLA {
+      format = "cnf"
+    }
+  }
+  if format != "cnf" && format != "pla" {
+    log.Fatalf("Unknown -to %q, expected cnf|pla", format)
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  var t *table
+  if isPLA {
+    t, err = parsePLA(file)
+  } else {
+    t, err = parseCNF(file)
+  }
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  if *minimize {
+    before := len(t.clauses)
+    t.clauses = minimizeClauses(t.clauses)
+    log.Printf("minimized %d clauses to %d", before, len(t.clauses))
+  }
+  if format == "pla" {
+    err = writePLA(os.Stdout, t)
+  } else {
+    err = writeCNF(os.Stdout, t)
+  }
+  if err != nil {
+    log.Fatalln(err)
+  }
+}
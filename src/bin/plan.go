@@ -0,0 +1,392 @@
+/*
+A simple binary which encodes a STRIPS planning problem as a CNF for a bounded number of steps,
+and decodes a solver's model back into a plan.
+Can be run by `plan -f <PROBLEM> -bound 4 > out.cnf`, then with `-model <FILE>` on the solver's
+output to list the actions of each step. With a solver command after `--`, as in
+`plan -f <PROBLEM> -max-bound 20 -- kissat`, the bound is increased from `-min-bound` until the
+solver finds a plan, which is printed. `{}` in the command's arguments is replaced by the path of
+the CNF, which is appended if there is no `{}`, and the command must write its answer to stdout
+in the competition format. There is no incremental solver here, so each bound is solved from
+scratch.
+
+The problem is JSON of the form
+`{"init": ["at-a"], "goal": ["at-b"], "actions": [{"name": "move", "pre": ["at-a"], "add": ["at-b"], "del": ["at-a"]}]}`.
+Fluents are the names mentioned anywhere, and those not in `init` are false initially.
+Preconditions are positive, and a fluent both added and deleted by an action is added.
+
+Each fluent has a variable per step 0..bound, and each action a variable per step 0..bound-1,
+named `<name>@<step>` by `c var` comments. An action at a step requires its preconditions at that
+step and its effects at the next, and explanatory frame axioms require a fluent which changes to
+be changed by some action. Several actions may share a step when none deletes a precondition or
+an add of another, so any order of them is a valid plan, and a step may be empty, so a plan
+found for a bound is no longer than it.
+*/
+package main
+
+import (
+  "bufio"
+  "encoding/json"
+  "errors"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "os/exec"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "JSON planning problem to encode")
+var bound = flag.Int("bound", 1, "Number of steps to encode, or to decode with -model")
+var modelPath = flag.String("model", "", "Decode this solver output into a plan instead of encoding")
+var minBound = flag.Int("min-bound", 0, "With a solver command, the first bound to try")
+var maxBound = flag.Int("max-bound", 32, "With a solver command, the last bound to try")
+
+type action struct {
+  Name string   `json:"name"`
+  Pre  []string `json:"pre"`
+  Add  []string `json:"add"`
+  Del  []string `json:"del"`
+}
+
+type problem struct {
+  Init    []string `json:"init"`
+  Goal    []string `json:"goal"`
+  Actions []action `json:"actions"`
+
+  // fluents in order of first mention, and their indices.
+  fluents []string
+  index   map[string]int
+}
+
+func parseProblem(r io.Reader) (*problem, error) {
+  p := &problem{index: map[string]int{}}
+  if err := json.NewDecoder(r).Decode(p); err != nil {
+    return nil, err
+  }
+  mention := func(names []string) {
+    for _, n := range names {
+      if _, ok := p.index[n]; !ok {
+        p.index[n] = len(p.fluents)
+        p.fluents = append(p.fluents, n)
+      }
+    }
+  }
+  mention(p.Init)
+  mention(p.Goal)
+  seen := map[string]bool{}
+  for _, a := range p.Actions {
+    if a.Name == "" {
+      return nil, errors.New("action without a name")
+    }
+    if seen[a.Name] {
+      return nil, fmt.Errorf("duplicate action %q", a.Name)
+    }
+    seen[a.Name] = true
+    mention(a.Pre)
+    mention(a.Add)
+    mention(a.Del)
+  }
+  return p, nil
+}
+
+// fluent returns the variable of fluent f at step t.
+func (p *problem) fluent(f, t int) int {
+  return t*(len(p.fluents)+len(p.Actions)) + f + 1
+}
+
+// action returns the variable of action a at step t.
+func (p *problem) action(a, t int) int {
+  return t*(len(p.fluents)+len(p.Actions)) + len(p.fluents) + a + 1
+}
+
+func (p *problem) indices(names []string) []int {
+  out := make([]int, len(names))
+  for i, n := range names {
+    out[i] = p.index[n]
+  }
+  return out
+}
+
+// interferes reports whether a deletes a precondition or an add of b.
+func (p *problem) interferes(a, b action) bool {
+  adds := map[string]bool{}
+  for _, n := range a.Add {
+    adds[n] = true
+  }
+  for _, d := range a.Del {
+    if adds[d] {
+      continue
+    }
+    for _, n := range b.Pre {
+      if n == d {
+        return true
+      }
+    }
+    for _, n := range b.Add {
+      if n == d {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+// encode returns the clauses whose models are the plans of at most bound steps, and the number
+// of variables used.
+func encode(p *problem, bound int) ([][]int, int) {
+  var clauses [][]int
+  initial := map[int]bool{}
+  for _, f := range p.indices(p.Init) {
+    initial[f] = true
+  }
+  for f := range p.fluents {
+    if initial[f] {
+      clauses = append(clauses, []int{p.fluent(f, 0)})
+    } else {
+      clauses = append(clauses, []int{-p.fluent(f, 0)})
+    }
+  }
+  for _, f := range p.indices(p.Goal) {
+    clauses = append(clauses, []int{p.fluent(f, bound)})
+  }
+  // adders and deleters of each fluent, by action index.
+  adders := make([][]int, len(p.fluents))
+  deleters := make([][]int, len(p.fluents))
+  for i, a := range p.Actions {
+    adds := map[int]bool{}
+    for _, f := range p.indices(a.Add) {
+      adds[f] = true
+      adders[f] = append(adders[f], i)
+    }
+    for _, f := range p.indices(a.Del) {
+      if !adds[f] {
+        deleters[f] = append(deleters[f], i)
+      }
+    }
+  }
+  var conflicts [][2]int
+  for i := range p.Actions {
+    for j := i + 1; j < len(p.Actions); j++ {
+      if p.interferes(p.Actions[i], p.Actions[j]) || p.interferes(p.Actions[j], p.Actions[i]) {
+        conflicts = append(conflicts, [2]int{i, j})
+      }
+    }
+  }
+  for t := 0; t < bound; t++ {
+    for i, a := range p.Actions {
+      v := p.action(i, t)
+      for _, f := range p.indices(a.Pre) {
+        clauses = append(clauses, []int{-v, p.fluent(f, t)})
+      }
+      for _, f := range p.indices(a.Add) {
+        clauses = append(clauses, []int{-v, p.fluent(f, t+1)})
+      }
+    }
+    for f := range p.fluents {
+      for _, i := range deleters[f] {
+        clauses = append(clauses, []int{-p.action(i, t), -p.fluent(f, t+1)})
+      }
+      becomesTrue := []int{p.fluent(f, t), -p.fluent(f, t+1)}
+      for _, i := range adders[f] {
+        becomesTrue = append(becomesTrue, p.action(i, t))
+      }
+      becomesFalse := []int{-p.fluent(f, t), p.fluent(f, t+1)}
+      for _, i := range deleters[f] {
+        becomesFalse = append(becomesFalse, p.action(i, t))
+      }
+      clauses = append(clauses, becomesTrue, becomesFalse)
+    }
+    for _, c := range conflicts {
+      clauses = append(clauses, []int{-p.action(c[0], t), -p.action(c[1], t)})
+    }
+  }
+  return clauses, p.fluent(len(p.fluents)-1, bound)
+}
+
+func writeDimacs(w io.Writer, p *problem, bound int) error {
+  clauses, vars := encode(p, bound)
+  b := bufio.NewWriter(w)
+  for t := 0; t <= bound; t++ {
+    for f, n := range p.fluents {
+      fmt.Fprintf(b, "c var %d %s@%d\n", p.fluent(f, t), n, t)
+    }
+    if t == bound {
+      break
+    }
+    for i, a := range p.Actions {
+      fmt.Fprintf(b, "c var %d %s@%d\n", p.action(i, t), a.Name, t)
+    }
+  }
+  fmt.Fprintf(b, "p cnf %d %d\n", vars, len(clauses))
+  for _, c := range clauses {
+    for _, l := range c {
+      fmt.Fprintf(b, "%d ", l)
+    }
+    b.WriteString("0\n")
+  }
+  return b.Flush()
+}
+
+// maxLine is the longest line of solver output decode accepts.
+const maxLine = 64 * 1024 * 1024
+
+// decode returns the actions of each step of the model in r, and false if the solver reported
+// no model.
+func decode(r io.Reader, p *problem, bound int) ([][]string, bool, error) {
+  steps := make([][]string, bound)
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  found := false
+  for scanner.Scan() {
+    line++
+    parts := strings.Fields(scanner.Text())
+    if len(parts) == 0 || parts[0] == "c" {
+      continue
+    }
+    if parts[0] == "s" {
+      if len(parts) > 1 && parts[1] == "UNSATISFIABLE" {
+        return nil, false, nil
+      }
+      continue
+    }
+    if parts[0] == "v" {
+      parts = parts[1:]
+    }
+    for _, part := range parts {
+      l, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, false, fmt.Errorf("line %d: invalid literal %s", line, part)
+      }
+      found = true
+      if l <= 0 {
+        continue
+      }
+      width := len(p.fluents) + len(p.Actions)
+      t, i := (l-1)/width, (l-1)%width-len(p.fluents)
+      if t < bound && i >= 0 {
+        steps[t] = append(steps[t], p.Actions[i].Name)
+      }
+    }
+  }
+  return steps, found, scanner.Err()
+}
+
+// printPlan writes the actions of each step which has any to w, followed by their number.
+func printPlan(w io.Writer, steps [][]string) {
+  n := 0
+  for t, names := range steps {
+    if len(names) == 0 {
+      continue
+    }
+    fmt.Fprintf(w, "%d: %s\n", t, strings.Join(names, " "))
+    n += len(names)
+  }
+  fmt.Fprintf(w, "plan of %d actions\n", n)
+}
+
+// solve runs command on the encoding of p for the given bound, and returns the plan it found,
+// or false if there is none.
+func solve(command []string, scratch string, p *problem, bound int) ([][]string, bool, error) {
+  file, err := os.Create(scratch)
+  if err != nil {
+    return nil, false, err
+  }
+  err = writeDimacs(file, p, bound)
+  if cerr := file.Close(); err == nil {
+    err = cerr
+  }
+  if err != nil {
+    return nil, false, err
+  }
+  args := make([]string, 0, len(command))
+  replaced := false
+  for _, a := range command[1:] {
+    if strings.Contains(a, "{}") {
+      replaced = true
+    }
+    args = append(args, strings.ReplaceAll(a, "{}", scratch))
+  }
+  if !replaced {
+    args = append(args, scratch)
+  }
+  cmd := exec.Command(command[0], args...)
+  cmd.Stderr = os.Stderr
+  out, err := cmd.Output()
+  // solvers exit with 10 or 20 to report their answer.
+  var exitErr *exec.ExitError
+  if err != nil && !errors.As(err, &exitErr) {
+    return nil, false, err
+  }
+  steps, ok, err := decode(strings.NewReader(string(out)), p, bound)
+  if err == nil && !ok && !strings.Contains(string(out), "UNSATISFIABLE") {
+    err = fmt.Errorf("%s gave neither a model nor UNSATISFIABLE", command[0])
+  }
+  return steps, ok, err
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  p, err := parseProblem(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  if len(p.fluents) == 0 {
+    log.Fatalf("%s: no fluents", *filePath)
+  }
+  if flag.NArg() > 0 {
+    scratch, err := os.CreateTemp("", "plan-*.cnf")
+    if err != nil {
+      log.Fatalln(err)
+    }
+    scratch.Close()
+    defer os.Remove(scratch.Name())
+    for b := *minBound; b <= *maxBound; b++ {
+      steps, ok, err := solve(flag.Args(), scratch.Name(), p, b)
+      if err != nil {
+        log.Fatalf("bound %d: %v", b, err)
+      }
+      if ok {
+        log.Printf("found a plan at bound %d", b)
+        printPlan(os.Stdout, steps)
+        return
+      }
+    }
+    os.Remove(scratch.Name())
+    fmt.Printf("no plan of at most %d steps\n", *maxBound)
+    os.Exit(1)
+  }
+  if *bound < 0 {
+    log.Fatalln("-bound must not be negative")
+  }
+  if *modelPath == "" {
+    if err := writeDimacs(os.Stdout, p, *bound); err != nil {
+      log.Fatalln(err)
+    }
+    return
+  }
+  model, err := os.Open(*modelPath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  steps, ok, err := decode(model, p, *bound)
+  model.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *modelPath, err)
+  }
+  if !ok {
+    fmt.Printf("no plan of at most %d steps\n", *bound)
+    return
+  }
+  printPlan(os.Stdout, steps)
+}
@@ -0,0 +1,251 @@
+/*
+A simple binary which flips the polarity of variables of a dimacs file so that every variable
+occurs positively at least as often as negatively, and reports which variables were flipped.
+Can be run by `polarity -f <FILE> -map flips.txt > out.cnf`.
+
+A variable is flipped, replacing each of its literals by its negation, if it has more negative
+than positive occurrences, so pure literals all become positive. The result is satisfiable
+exactly when the input is, and a model of it with the flipped variables negated is a model of
+the input. Variables named by `c var` comments keep their number, and the name of a flipped one
+is prefixed with `~`.
+
+`-map` writes the flipped variables, one `<v> -<v>` pair per line, and the number of flipped
+and pure variables is logged. The flips only depend on the input, so
+`polarity -f <FILE> -model <MODEL>` maps a solver's model of the output back to the input,
+rewriting the `v` lines of the competition format, or a plain list of literals.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "File to rewrite")
+var mapPath = flag.String("map", "", "Write the flipped variables to this file")
+var modelPath = flag.String("model", "", "Map this model of the rewritten formula back to the input instead of rewriting")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// formula is a parsed input, vars is the larger of the header's variable count and the largest
+// variable used.
+type formula struct {
+  vars    int
+  clauses [][]int
+  names   map[int]string
+}
+
+// maxLine is the longest line of a formula or of solver output that is accepted.
+const maxLine = 64 * 1024 * 1024
+
+func parse(r io.Reader) (*formula, error) {
+  f := &formula{names: map[int]string{}}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          f.names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      parts := strings.Fields(t)
+      if len(parts) == 4 {
+        if v, err := strconv.Atoi(parts[2]); err == nil {
+          f.vars = max(f.vars, v)
+        }
+      }
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        f.clauses = append(f.clauses, curr)
+        curr = nil
+      } else {
+        f.vars = max(f.vars, abs(item))
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return f, scanner.Err()
+}
+
+// flips returns whether each variable of f is flipped, indexed by variable, and the number of
+// variables which are pure.
+func flips(f *formula) ([]bool, int) {
+  pos := make([]int, f.vars+1)
+  neg := make([]int, f.vars+1)
+  for _, c := range f.clauses {
+    for _, l := range c {
+      if l > 0 {
+        pos[l]++
+      } else {
+        neg[-l]++
+      }
+    }
+  }
+  flip := make([]bool, f.vars+1)
+  pure := 0
+  for v := 1; v <= f.vars; v++ {
+    flip[v] = neg[v] > pos[v]
+    if (pos[v] == 0) != (neg[v] == 0) {
+      pure++
+    }
+  }
+  return flip, pure
+}
+
+func write(w io.Writer, f *formula, flip []bool) error {
+  b := bufio.NewWriter(w)
+  vars := make([]int, 0, len(f.names))
+  for v := range f.names {
+    vars = append(vars, v)
+  }
+  sort.Ints(vars)
+  for _, v := range vars {
+    name := f.names[v]
+    if v < len(flip) && flip[v] {
+      name = "~" + name
+    }
+    fmt.Fprintf(b, "c var %d %s\n", v, name)
+  }
+  fmt.Fprintf(b, "p cnf %d %d\n", f.vars, len(f.clauses))
+  for _, c := range f.clauses {
+    for _, l := range c {
+      if flip[abs(l)] {
+        l = -l
+      }
+      fmt.Fprintf(b, "%d ", l)
+    }
+    b.WriteString("0\n")
+  }
+  return b.Flush()
+}
+
+func writeMap(path string, flip []bool) error {
+  file, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  b := bufio.NewWriter(file)
+  for v, flipped := range flip {
+    if flipped {
+      fmt.Fprintf(b, "%d -%d\n", v, v)
+    }
+  }
+  err = b.Flush()
+  if cerr := file.Close(); err == nil {
+    err = cerr
+  }
+  return err
+}
+
+// unflip copies the solver output in r to w, negating the literals of flipped variables.
+func unflip(w io.Writer, r io.Reader, flip []bool) error {
+  b := bufio.NewWriter(w)
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    parts := strings.Fields(t)
+    if len(parts) == 0 || (parts[0] != "v" && !strings.ContainsAny(parts[0][:1], "-0123456789")) {
+      b.WriteString(t)
+      b.WriteByte('\n')
+      continue
+    }
+    for i, part := range parts {
+      if part == "v" {
+        continue
+      }
+      l, err := strconv.Atoi(part)
+      if err != nil {
+        return fmt.Errorf("line %d: invalid literal %s", line, part)
+      }
+      if abs(l) < len(flip) && flip[abs(l)] {
+        parts[i] = strconv.Itoa(-l)
+      }
+    }
+    b.WriteString(strings.Join(parts, " "))
+    b.WriteByte('\n')
+  }
+  if err := scanner.Err(); err != nil {
+    return err
+  }
+  return b.Flush()
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  f, err := parse(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  flip, pure := flips(f)
+  if *modelPath != "" {
+    model, err := os.Open(*modelPath)
+    if err != nil {
+      log.Fatalln(err)
+    }
+    err = unflip(os.Stdout, model, flip)
+    model.Close()
+    if err != nil {
+      log.Fatalf("%s: %v", *modelPath, err)
+    }
+    return
+  }
+  flipped := 0
+  for _, b := range flip {
+    if b {
+      flipped++
+    }
+  }
+  log.Printf("flipped %d of %d variables, %d are pure", flipped, f.vars, pure)
+  if *mapPath != "" {
+    if err := writeMap(*mapPath, flip); err != nil {
+      log.Fatalln(err)
+    }
+  }
+  if err := write(os.Stdout, f, flip); err != nil {
+    log.Fatalln(err)
+  }
+}
@@ -0,0 +1,848 @@
+/*
+A simple binary to render the derivation DAG of a DRAT or LRAT proof as a graphviz or GraphML
+graph. Original clauses are boxes, lemmas are ellipses, and edges run from the clauses used to
+derive a lemma to the lemma. Clauses which the proof deletes are greyed out.
+Can be run by `proof_graph -f <CNF> -p <PROOF>`.
+
+LRAT proofs carry the antecedents of each lemma as hints. DRAT proofs do not, so the antecedents
+are recovered by replaying the reverse unit propagation check of each lemma against the clauses
+active at that point. Lemmas which are not RUP (RAT lemmas) are drawn without antecedents.
+
+`-format outline` (or `html`) instead writes a resolution outline for teaching and auditing: only
+the clauses the empty clause depends on, in derivation order, each lemma explained as a chain of
+resolutions with its antecedents on named pivot variables. Variables named by
+`c var <n> <name>` comments in the CNF are written by name in every format. The outline gives
+the line of the CNF each original clause starts on, and the other formats the line of the CNF or
+proof of every clause, as a tooltip or a `line` attribute, to find them in generated files.
+
+Full proof DAGs are rarely renderable, so `-lemma <ID>` keeps only the derivation cone of one
+clause, with the original clauses it depends on at the leaves, in every format. Ids are the
+LRAT clause ids, and for DRAT proofs lemmas are numbered after the original clauses in the order
+the proof adds them.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "html"
+  "io"
+  "log"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+var cnfPath = flag.String("f", "", "CNF file the proof refers to")
+var proofPath = flag.String("p", "", "DRAT or LRAT proof file")
+var proofFormat = flag.String("proof-format", "", "drat|lrat, by default lrat for .lrat files and drat otherwise")
+var outFormat = flag.String("format", "dot", "Output format: dot|graphml|outline|html")
+var lemma = flag.Int("lemma", 0, "Only show the derivation cone of the clause with this id")
+var showProgress = flag.Bool("progress", false, "Report how much of a large proof has been read on stderr")
+
+// progressBytes is the proof size above which -progress reports.
+const progressBytes = 1024 * 1024
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// names maps variables to the names given by `c var <n> <name>` comments in the CNF.
+var names = map[int]string{}
+
+func litString(lit int) string {
+  name, ok := names[abs(lit)]
+  if !ok {
+    return strconv.Itoa(lit)
+  }
+  if lit < 0 {
+    return "-" + name
+  }
+  return name
+}
+
+func clauseString(c []int) string {
+  var s = "("
+  for i, lit := range c {
+    if i > 0 {
+      s += ", "
+    }
+    s += litString(lit)
+  }
+  s += ")"
+  return s
+}
+
+// node is a clause in the proof, either original or derived.
+type node struct {
+  lits []int
+  original bool
+  deleted bool
+  // antecedents are the ids of the clauses this lemma was derived from.
+  antecedents []int
+  // line is the line the clause starts on in the CNF if it is original, or else in the proof.
+  line int
+}
+
+// proof is the derivation DAG, indexed by clause id. Ids start at 1 as in LRAT.
+type proof struct {
+  nodes map[int]*node
+  order []int
+}
+
+func (p *proof) add(id int, n *node) {
+  p.nodes[id] = n
+  p.order = append(p.order, id)
+}
+
+// progressReader reports to w how much of an input has been read, with an ETA, at most a few
+// times a second.
+type progressReader struct {
+  r io.Reader
+  w io.Writer
+  name string
+  read, total int64
+  start, last time.Time
+  detail func() string
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+  n, err := p.r.Read(b)
+  p.read += int64(n)
+  now := time.Now()
+  if now.Sub(p.last) >= 200*time.Millisecond {
+    p.last = now
+    eta := "?"
+    if p.read > 0 {
+      eta = time.Duration(float64(now.Sub(p.start)) * float64(p.total-p.read) / float64(p.read)).Round(time.Second).String()
+    }
+    fmt.Fprintf(p.w, "\r%s: %5.1f%%, %.1f/%.1f MB, %s, ETA %s   ", p.name, 100*float64(p.read)/float64(p.total), float64(p.read)/1e6, float64(p.total)/1e6, p.detail(), eta)
+  }
+  if err == io.EOF {
+    fmt.Fprintf(p.w, "\r%s: done in %s\033[K\n", p.name, time.Since(p.start).Round(time.Millisecond))
+  }
+  return n, err
+}
+
+// ErrSyntax is returned for malformed input, at a 1-based line and column.
+type ErrSyntax struct {
+  Line, Col int
+  Msg string
+}
+
+func (e *ErrSyntax) Error() string {
+  return fmt.Sprintf("line %d, col %d: %s", e.Line, e.Col, e.Msg)
+}
+
+// ErrVarOutOfRange is returned for a literal of the CNF whose variable exceeds the header's
+// count. Proofs are not checked, as extended resolution introduces new variables.
+type ErrVarOutOfRange struct {
+  Line, Col int
+  Var, Max int
+}
+
+func (e *ErrVarOutOfRange) Error() string {
+  return fmt.Sprintf("line %d, col %d: variable %d exceeds declared %d", e.Line, e.Col, e.Var, e.Max)
+}
+
+// field is a whitespace separated token and its 1-based column.
+type field struct {
+  text string
+  col int
+}
+
+func splitFields(t string) []field {
+  var out []field
+  start := -1
+  for i := 0; i <= len(t); i++ {
+    if i == len(t) || t[i] == ' ' || t[i] == '\t' || t[i] == '\r' {
+      if start >= 0 {
+        out = append(out, field{t[start:i], start + 1})
+        start = -1
+      }
+    } else if start < 0 {
+      start = i
+    }
+  }
+  return out
+}
+
+// maxLine is the longest line readClauses accepts.
+const maxLine = 64 * 1024 * 1024
+
+// readClauses calls line with the fields and number of each line of r, skipping comments and
+// blank lines, and header with those of a `p` line if it is not nil.
+func readClauses(r io.Reader, line, header func(fields []field, num int) error, comment func(text string)) error {
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  lineNum := 0
+  for scanner.Scan() {
+    lineNum++
+    t := strings.TrimSpace(scanner.Text())
+    // old benchmark suites end the clauses with a `%` line followed by a stray `0`.
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") && comment != nil {
+      comment(t[1:])
+    }
+    if t == "" || strings.HasPrefix(t, "c") {
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      if header != nil {
+        if err := header(splitFields(scanner.Text()), lineNum); err != nil {
+          return err
+        }
+      }
+      continue
+    }
+    if err := line(splitFields(scanner.Text()), lineNum); err != nil {
+      return err
+    }
+  }
+  return scanner.Err()
+}
+
+// atoi parses the field f of line num, as a literal or clause id.
+func atoi(f field, num int) (int, error) {
+  n, err := strconv.Atoi(f.text)
+  if err != nil {
+    return 0, &ErrSyntax{num, f.col, "invalid literal " + f.text}
+  }
+  return n, nil
+}
+
+func atois(fields []field, num int) ([]int, error) {
+  out := make([]int, 0, len(fields))
+  for _, f := range fields {
+    n, err := atoi(f, num)
+    if err != nil {
+      return nil, err
+    }
+    out = append(out, n)
+  }
+  return out, nil
+}
+
+// parseCNF returns the clauses of a CNF and the line each starts on.
+func parseCNF(r io.Reader) ([][]int, []int, error) {
+  var clauses [][]int
+  var lines []int
+  var curr []int
+  start := 0
+  vars := -1
+  err := readClauses(r, func(fields []field, num int) error {
+    for _, part := range fields {
+      item, err := atoi(part, num)
+      if err != nil {
+        return err
+      }
+      if vars != -1 && abs(item) > vars {
+        return &ErrVarOutOfRange{num, part.col, abs(item), vars}
+      }
+      if start == 0 {
+        start = num
+      }
+      if item == 0 {
+        clauses = append(clauses, curr)
+        lines = append(lines, start)
+        curr, start = nil, 0
+      } else {
+        curr = append(curr, item)
+      }
+    }
+    return nil
+  }, func(fields []field, num int) error {
+    if len(fields) != 4 || fields[1].text != "cnf" {
+      return &ErrSyntax{num, 1, "expected header \"p cnf <vars> <clauses>\""}
+    }
+    n, err := strconv.Atoi(fields[2].text)
+    if err != nil || n < 0 {
+      return &ErrSyntax{num, fields[2].col, "invalid variable count " + fields[2].text}
+    }
+    vars = n
+    return nil
+  }, func(text string) {
+    parts := strings.Fields(text)
+    if len(parts) == 3 && parts[0] == "var" {
+      if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+        names[v] = parts[2]
+      }
+    }
+  })
+  return clauses, lines, err
+}
+
+// untilZero splits nums at its first zero.
+func untilZero(nums []int) ([]int, []int) {
+  for i, n := range nums {
+    if n == 0 {
+      return nums[:i], nums[i+1:]
+    }
+  }
+  return nums, nil
+}
+
+func parseLRAT(r io.Reader, p *proof) error {
+  return readClauses(r, func(fields []field, num int) error {
+    if len(fields) > 1 && fields[1].text == "d" {
+      ids, err := atois(fields[2:], num)
+      if err != nil {
+        return err
+      }
+      ids, _ = untilZero(ids)
+      for _, id := range ids {
+        if n, ok := p.nodes[id]; ok {
+          n.deleted = true
+        }
+      }
+      return nil
+    }
+    nums, err := atois(fields, num)
+    if err != nil {
+      return err
+    }
+    if len(nums) == 0 {
+      return nil
+    }
+    lits, rest := untilZero(nums[1:])
+    hints, _ := untilZero(rest)
+    n := &node{lits: lits, line: num}
+    for _, h := range hints {
+      if _, ok := p.nodes[abs(h)]; ok {
+        n.antecedents = append(n.antecedents, abs(h))
+      }
+    }
+    p.add(nums[0], n)
+    return nil
+  }, nil, nil)
+}
+
+// checker replays a DRAT proof with unit propagation to recover antecedents.
+type checker struct {
+  p *proof
+  // occurs maps a literal to the ids of the clauses containing it.
+  occurs map[int][]int
+  // byKey maps a sorted clause to the ids of active clauses with those literals.
+  byKey map[string][]int
+}
+
+func clauseKey(lits []int) string {
+  c := append([]int(nil), lits...)
+  sort.Ints(c)
+  return fmt.Sprint(c)
+}
+
+func (c *checker) activate(id int) {
+  n := c.p.nodes[id]
+  for _, l := range n.lits {
+    c.occurs[l] = append(c.occurs[l], id)
+  }
+  k := clauseKey(n.lits)
+  c.byKey[k] = append(c.byKey[k], id)
+}
+
+func (c *checker) remove(lits []int) {
+  k := clauseKey(lits)
+  ids := c.byKey[k]
+  if len(ids) == 0 {
+    return
+  }
+  id := ids[len(ids)-1]
+  c.byKey[k] = ids[:len(ids)-1]
+  c.p.nodes[id].deleted = true
+}
+
+func (c *checker) active(id int) bool {
+  return !c.p.nodes[id].deleted
+}
+
+// rup checks that lits follows from the active clauses by unit propagation, returning the
+// clauses involved in the conflict, or false if no conflict is reached.
+func (c *checker) rup(lits []int) ([]int, bool) {
+  value := map[int]bool{}
+  reason := map[int]int{}
+  var trail []int
+  assign := func(l int, why int) {
+    value[abs(l)] = l > 0
+    reason[abs(l)] = why
+    trail = append(trail, l)
+  }
+  isTrue := func(l int) bool {
+    v, ok := value[abs(l)]
+    return ok && v == (l > 0)
+  }
+  isFalse := func(l int) bool {
+    v, ok := value[abs(l)]
+    return ok && v != (l > 0)
+  }
+  for _, l := range lits {
+    if isTrue(-l) {
+      continue
+    }
+    if isFalse(-l) {
+      // lemma is a tautology, nothing to derive it from.
+      return nil, true
+    }
+    assign(-l, 0)
+  }
+  conflict := 0
+  // scan each clause once at the start for units and conflicts, then only on assignments.
+  check := func(id int) bool {
+    var unit int
+    unassigned := 0
+    for _, l := range c.p.nodes[id].lits {
+      if isTrue(l) {
+        return false
+      }
+      if !isFalse(l) {
+        unassigned++
+        unit = l
+      }
+    }
+    switch unassigned {
+    case 0:
+      conflict = id
+      return true
+    case 1:
+      assign(unit, id)
+    }
+    return false
+  }
+  for _, id := range c.p.order {
+    if !c.active(id) {
+      continue
+    }
+    if check(id) {
+      break
+    }
+  }
+  for i := 0; conflict == 0 && i < len(trail); i++ {
+    for _, id := range c.occurs[-trail[i]] {
+      if c.active(id) && check(id) {
+        break
+      }
+    }
+  }
+  if conflict == 0 {
+    return nil, false
+  }
+  // walk back from the conflict through the reasons of the falsified literals.
+  used := map[int]bool{conflict: true}
+  seen := map[int]bool{}
+  queue := []int{conflict}
+  for len(queue) > 0 {
+    id := queue[0]
+    queue = queue[1:]
+    for _, l := range c.p.nodes[id].lits {
+      v := abs(l)
+      if seen[v] {
+        continue
+      }
+      seen[v] = true
+      if r := reason[v]; r != 0 && !used[r] {
+        used[r] = true
+        queue = append(queue, r)
+      }
+    }
+  }
+  var out []int
+  for id := range used {
+    out = append(out, id)
+  }
+  sort.Ints(out)
+  return out, true
+}
+
+func parseDRAT(r io.Reader, p *proof) error {
+  c := &checker{p, map[int][]int{}, map[string][]int{}}
+  for _, id := range p.order {
+    c.activate(id)
+  }
+  next := len(p.order) + 1
+  var curr []int
+  deleting := false
+  start := 0
+  return readClauses(r, func(fields []field, num int) error {
+    for _, part := range fields {
+      if start == 0 {
+        start = num
+      }
+      if part.text == "d" {
+        deleting = true
+        continue
+      }
+      item, err := atoi(part, num)
+      if err != nil {
+        return err
+      }
+      if item != 0 {
+        curr = append(curr, item)
+        continue
+      }
+      if deleting {
+        c.remove(curr)
+      } else {
+        n := &node{lits: curr, line: start}
+        n.antecedents, _ = c.rup(curr)
+        p.add(next, n)
+        c.activate(next)
+        next++
+      }
+      curr, start = nil, 0
+      deleting = false
+    }
+    return nil
+  }, nil, nil)
+}
+
+func nodeAttrs(n *node) string {
+  label := strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(clauseString(n.lits))
+  attrs := []string{fmt.Sprintf("label = \"%s\"", label)}
+  switch {
+  case n.original:
+    attrs = append(attrs, "shape = box")
+  case len(n.lits) == 0:
+    attrs = append(attrs, "shape = doubleoctagon", "color = red")
+  }
+  where := "proof"
+  if n.original {
+    where = "CNF"
+  }
+  attrs = append(attrs, fmt.Sprintf("tooltip = \"%s line %d\"", where, n.line))
+  if n.deleted {
+    attrs = append(attrs, "color = gray", "fontcolor = gray")
+  }
+  return strings.Join(attrs, ", ")
+}
+
+func writeDOT(w io.Writer, p *proof) {
+  b := bufio.NewWriter(w)
+  defer b.Flush()
+  b.WriteString("digraph {\n")
+  for _, id := range p.order {
+    fmt.Fprintf(b, "  %d [ %s ]\n", id, nodeAttrs(p.nodes[id]))
+  }
+  for _, id := range p.order {
+    n := p.nodes[id]
+    for _, a := range n.antecedents {
+      if p.nodes[a].deleted {
+        fmt.Fprintf(b, "  %d -> %d [ color = gray ]\n", a, id)
+        continue
+      }
+      fmt.Fprintf(b, "  %d -> %d\n", a, id)
+    }
+  }
+  b.WriteString("}\n")
+}
+
+func writeGraphML(w io.Writer, p *proof) {
+  b := bufio.NewWriter(w)
+  defer b.Flush()
+  b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+  b.WriteString("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+  b.WriteString("  <key id=\"clause\" for=\"node\" attr.name=\"clause\" attr.type=\"string\"/>\n")
+  b.WriteString("  <key id=\"original\" for=\"node\" attr.name=\"original\" attr.type=\"boolean\"/>\n")
+  b.WriteString("  <key id=\"deleted\" for=\"node\" attr.name=\"deleted\" attr.type=\"boolean\"/>\n")
+  b.WriteString("  <key id=\"line\" for=\"node\" attr.name=\"line\" attr.type=\"int\"/>\n")
+  b.WriteString("  <graph edgedefault=\"directed\">\n")
+  for _, id := range p.order {
+    n := p.nodes[id]
+    fmt.Fprintf(b, "    <node id=\"%d\">\n", id)
+    fmt.Fprintf(b, "      <data key=\"clause\">%s</data>\n", html.EscapeString(clauseString(n.lits)))
+    fmt.Fprintf(b, "      <data key=\"original\">%t</data>\n", n.original)
+    fmt.Fprintf(b, "      <data key=\"deleted\">%t</data>\n", n.deleted)
+    fmt.Fprintf(b, "      <data key=\"line\">%d</data>\n", n.line)
+    b.WriteString("    </node>\n")
+  }
+  for _, id := range p.order {
+    for _, a := range p.nodes[id].antecedents {
+      fmt.Fprintf(b, "    <edge source=\"%d\" target=\"%d\"/>\n", a, id)
+    }
+  }
+  b.WriteString("  </graph>\n</graphml>\n")
+}
+
+// restrict returns the part of p made of the clauses in ids.
+func restrict(p *proof, ids []int) *proof {
+  out := &proof{nodes: map[int]*node{}}
+  for _, id := range ids {
+    out.add(id, p.nodes[id])
+  }
+  return out
+}
+
+// goal returns the clause whose derivation is shown, -lemma or else the first derived empty
+// clause, or 0 if there is none.
+func goal(p *proof) int {
+  if *lemma != 0 {
+    return *lemma
+  }
+  for _, id := range p.order {
+    if n := p.nodes[id]; !n.original && len(n.lits) == 0 {
+      return id
+    }
+  }
+  return 0
+}
+
+// cone returns the ids of the clauses clause goal depends on, including itself, in derivation
+// order.
+func cone(p *proof, goal int) []int {
+  needed := map[int]bool{goal: true}
+  queue := []int{goal}
+  for len(queue) > 0 {
+    id := queue[0]
+    queue = queue[1:]
+    for _, a := range p.nodes[id].antecedents {
+      if !needed[a] {
+        needed[a] = true
+        queue = append(queue, a)
+      }
+    }
+  }
+  var out []int
+  for _, id := range p.order {
+    if needed[id] {
+      out = append(out, id)
+      if id == goal {
+        break
+      }
+    }
+  }
+  return out
+}
+
+// outlined returns the clauses to outline, those the goal depends on or every clause if there
+// is no goal, and a description of them.
+func outlined(p *proof) ([]int, string) {
+  g := goal(p)
+  switch {
+  case g == 0:
+    return p.order, "the proof derives no empty clause, so every clause is outlined"
+  case *lemma != 0:
+    ids := cone(p, g)
+    return ids, fmt.Sprintf("outline of the %d clauses clause %d depends on", len(ids), g)
+  }
+  ids := cone(p, g)
+  return ids, fmt.Sprintf("outline of the %d clauses the empty clause depends on", len(ids))
+}
+
+// resolution is one step of a resolution chain, resolving with clause id on variable pivot.
+type resolution struct {
+  id, pivot int
+}
+
+// chain turns the antecedents of a lemma into a linear resolution derivation: it propagates the
+// negation of the lemma over the antecedents alone, then resolves backwards from the conflict
+// with the reason of each falsified literal. It returns the clause the chain starts from, or 0
+// if the antecedents do not propagate to a conflict.
+func chain(p *proof, n *node) (int, []resolution) {
+  value := map[int]bool{}
+  reason := map[int]int{}
+  var trail []int
+  for _, l := range n.lits {
+    value[abs(l)] = l < 0
+  }
+  conflict := 0
+  for changed := true; changed && conflict == 0; {
+    changed = false
+    for _, id := range n.antecedents {
+      var unit int
+      unassigned, satisfied := 0, false
+      for _, l := range p.nodes[id].lits {
+        v, ok := value[abs(l)]
+        switch {
+        case !ok:
+          unassigned++
+          unit = l
+        case v == (l > 0):
+          satisfied = true
+        }
+      }
+      if satisfied {
+        continue
+      }
+      if unassigned == 0 {
+        conflict = id
+        break
+      }
+      if unassigned == 1 {
+        value[abs(unit)] = unit > 0
+        reason[abs(unit)] = id
+        trail = append(trail, unit)
+        changed = true
+      }
+    }
+  }
+  if conflict == 0 {
+    return 0, nil
+  }
+  resolvent := map[int]bool{}
+  for _, l := range p.nodes[conflict].lits {
+    resolvent[l] = true
+  }
+  var steps []resolution
+  for i := len(trail) - 1; i >= 0; i-- {
+    l := trail[i]
+    if !resolvent[-l] {
+      continue
+    }
+    delete(resolvent, -l)
+    for _, m := range p.nodes[reason[abs(l)]].lits {
+      if m != l {
+        resolvent[m] = true
+      }
+    }
+    steps = append(steps, resolution{reason[abs(l)], abs(l)})
+  }
+  return conflict, steps
+}
+
+// explanation describes how clause id was derived.
+func explanation(p *proof, id int, ref func(id int) string) string {
+  n := p.nodes[id]
+  if n.original {
+    return fmt.Sprintf("original clause at line %d", n.line)
+  }
+  if len(n.antecedents) == 0 {
+    return "by RAT, or a tautology"
+  }
+  start, steps := chain(p, n)
+  if start == 0 {
+    refs := make([]string, len(n.antecedents))
+    for i, a := range n.antecedents {
+      refs[i] = ref(a)
+    }
+    return "from " + strings.Join(refs, ", ")
+  }
+  parts := []string{"resolve " + ref(start)}
+  for _, s := range steps {
+    parts = append(parts, fmt.Sprintf("with %s on %s", ref(s.id), litString(s.pivot)))
+  }
+  return strings.Join(parts, ", ")
+}
+
+// writeOutline writes the clauses the empty clause depends on, one line each with how it was
+// derived.
+func writeOutline(w io.Writer, p *proof) {
+  b := bufio.NewWriter(w)
+  defer b.Flush()
+  ids, desc := outlined(p)
+  fmt.Fprintf(b, "c %s\n", desc)
+  ref := func(id int) string { return strconv.Itoa(id) }
+  clauses := make([]string, len(ids))
+  width := 0
+  for i, id := range ids {
+    clauses[i] = clauseString(p.nodes[id].lits)
+    width = max(width, len(clauses[i]))
+  }
+  for i, id := range ids {
+    fmt.Fprintf(b, "%6d  %-*s  %s\n", id, width, clauses[i], explanation(p, id, ref))
+  }
+}
+
+// writeHTML writes the outline as an html table, with references linking to the rows of the
+// clauses they refer to.
+func writeHTML(w io.Writer, p *proof) {
+  b := bufio.NewWriter(w)
+  defer b.Flush()
+  ids, desc := outlined(p)
+  b.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>proof outline</title>\n")
+  b.WriteString("<style>td { padding: 0 1em; font-family: monospace; } tr.original { color: gray; } :target { background: #ffc; }</style>\n")
+  b.WriteString("</head>\n<body>\n")
+  fmt.Fprintf(b, "<p>%s.</p>\n", html.EscapeString(strings.ToUpper(desc[:1])+desc[1:]))
+  b.WriteString("<table>\n")
+  ref := func(id int) string { return fmt.Sprintf("<a href=\"#c%d\">%d</a>", id, id) }
+  for _, id := range ids {
+    n := p.nodes[id]
+    class := "lemma"
+    if n.original {
+      class = "original"
+    }
+    // pivots are named by litString, so escape the explanation apart from the links.
+    expl := explanation(p, id, func(id int) string { return "\x00" + strconv.Itoa(id) + "\x01" })
+    expl = html.EscapeString(expl)
+    for _, a := range n.antecedents {
+      expl = strings.ReplaceAll(expl, "\x00"+strconv.Itoa(a)+"\x01", ref(a))
+    }
+    fmt.Fprintf(b, "<tr id=\"c%d\" class=\"%s\"><td>%d</td><td>%s</td><td>%s</td></tr>\n", id, class, id, html.EscapeString(clauseString(n.lits)), expl)
+  }
+  b.WriteString("</table>\n</body>\n</html>\n")
+}
+
+func main() {
+  flag.Parse()
+  if *cnfPath == "" || *proofPath == "" {
+    log.Fatalln("Must pass CNF file and proof")
+  }
+  cnf, err := os.Open(*cnfPath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  clauses, lines, err := parseCNF(cnf)
+  cnf.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *cnfPath, err)
+  }
+  p := &proof{nodes: map[int]*node{}}
+  for i, c := range clauses {
+    p.add(i+1, &node{lits: c, original: true, line: lines[i]})
+  }
+  proofFile, err := os.Open(*proofPath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  defer proofFile.Close()
+  var proofInput io.Reader = proofFile
+  if info, err := proofFile.Stat(); err == nil && *showProgress && info.Size() >= progressBytes {
+    proofInput = &progressReader{
+      r: proofFile, w: os.Stderr, name: *proofPath, total: info.Size(), start: time.Now(),
+      detail: func() string { return fmt.Sprintf("%d clauses", len(p.order)) },
+    }
+  }
+  format := *proofFormat
+  if format == "" {
+    format = "drat"
+    if filepath.Ext(*proofPath) == ".lrat" {
+      format = "lrat"
+    }
+  }
+  switch format {
+  case "lrat":
+    err = parseLRAT(proofInput, p)
+  case "drat":
+    err = parseDRAT(proofInput, p)
+  default:
+    log.Fatalf("Unknown -proof-format %q, expected drat|lrat", format)
+  }
+  if err != nil {
+    log.Fatalf("%s: %v", *proofPath, err)
+  }
+  if *lemma != 0 {
+    if _, ok := p.nodes[*lemma]; !ok {
+      log.Fatalf("No clause with id %d in the proof", *lemma)
+    }
+    p = restrict(p, cone(p, *lemma))
+  }
+  switch *outFormat {
+  case "dot":
+    writeDOT(os.Stdout, p)
+  case "graphml":
+    writeGraphML(os.Stdout, p)
+  case "outline":
+    writeOutline(os.Stdout, p)
+  case "html":
+    writeHTML(os.Stdout, p)
+  default:
+    log.Fatalf("Unknown -format %q, expected dot|graphml|outline|html", *outFormat)
+  }
+}
@@ -0,0 +1,215 @@
+/*
+A simple binary which writes a dimacs file as an SMT-LIB2 script, for cross checking a
+formula's answer, model or core with an SMT solver such as Z3 or CVC5.
+Can be run by `smtlib -f <FILE> > out.smt2`, and then `z3 out.smt2`.
+
+Each variable becomes a Bool constant, named by its `c var` comment when that is a valid
+symbol not used by another variable, and `x<n>` otherwise, unless `-names=false`. Each clause
+becomes an assertion of the disjunction of its literals, so an empty clause asserts false. The
+script ends with `(check-sat)`, followed by `(get-model)` with `-model`. With `-core` each
+assertion is named `c<i>` for the i-th clause, counting from 1, and the script asks for an
+unsat core, whose names give the clauses of the input it is made of.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "File to export")
+var useNames = flag.Bool("names", true, "Name constants by the \"c var <n> <name>\" comments")
+var getModel = flag.Bool("model", false, "Ask for a model after checking satisfiability")
+var getCore = flag.Bool("core", false, "Name each clause's assertion and ask for an unsat core")
+
+func abs(n int) int {
+  if n > 0 {
+    return n
+  }
+  return -n
+}
+
+// formula is a parsed input, vars is the larger of the header's variable count and the largest
+// variable used.
+type formula struct {
+  vars    int
+  clauses [][]int
+  names   map[int]string
+}
+
+// maxLine is the longest line the parser accepts.
+const maxLine = 64 * 1024 * 1024
+
+func parse(r io.Reader) (*formula, error) {
+  f := &formula{names: map[int]string{}}
+  var curr []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    t := scanner.Text()
+    if strings.HasPrefix(t, "%") {
+      break
+    }
+    if strings.HasPrefix(t, "c") {
+      parts := strings.Fields(t[1:])
+      if len(parts) == 3 && parts[0] == "var" {
+        if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+          f.names[v] = parts[2]
+        }
+      }
+      continue
+    }
+    if strings.HasPrefix(t, "p") {
+      parts := strings.Fields(t)
+      if len(parts) == 4 {
+        if v, err := strconv.Atoi(parts[2]); err == nil {
+          f.vars = max(f.vars, v)
+        }
+      }
+      continue
+    }
+    for _, part := range strings.Fields(t) {
+      item, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, fmt.Errorf("line %d: %w", line, err)
+      }
+      if item == 0 {
+        f.clauses = append(f.clauses, curr)
+        curr = nil
+      } else {
+        f.vars = max(f.vars, abs(item))
+        curr = append(curr, item)
+      }
+    }
+  }
+  if len(curr) > 0 {
+    return nil, fmt.Errorf("line %d: last clause is not terminated by 0", line)
+  }
+  return f, scanner.Err()
+}
+
+// reserved words of SMT-LIB2 which are not valid simple symbols, along with the constants and
+// the other functions of the Core theory, which a constant must not shadow.
+var reserved = map[string]bool{
+  "true": true, "false": true, "not": true, "or": true, "and": true, "assert": true,
+  "=>": true, "xor": true, "=": true, "distinct": true, "ite": true,
+  "_": true, "!": true, "as": true, "let": true, "exists": true, "forall": true, "match": true,
+  "par": true, "NUMERAL": true, "DECIMAL": true, "STRING": true, "BINARY": true,
+  "HEXADECIMAL": true,
+}
+
+// isSymbol reports whether name is a simple symbol: a non-empty sequence of letters, digits and
+// the characters ~!@$%^&*_-+=<>.?/ not starting with a digit, or with @ or . which SMT-LIB2
+// reserves for solvers.
+func isSymbol(name string) bool {
+  if name == "" || reserved[name] || (name[0] >= '0' && name[0] <= '9') || name[0] == '@' || name[0] == '.' {
+    return false
+  }
+  for _, r := range name {
+    switch {
+    case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+    case strings.ContainsRune("~!@$%^&*_-+=<>.?/", r):
+    default:
+      return false
+    }
+  }
+  return true
+}
+
+// symbols returns the constant of each variable, indexed by variable.
+func symbols(f *formula, useNames bool) []string {
+  syms := make([]string, f.vars+1)
+  taken := map[string]bool{}
+  for v := 1; v <= f.vars; v++ {
+    syms[v] = "x" + strconv.Itoa(v)
+    taken[syms[v]] = true
+  }
+  if !useNames {
+    return syms
+  }
+  // the names of -core's assertions share the namespace of constants.
+  if *getCore {
+    for i := range f.clauses {
+      taken["c"+strconv.Itoa(i+1)] = true
+    }
+  }
+  for v := 1; v <= f.vars; v++ {
+    name, ok := f.names[v]
+    if ok && isSymbol(name) && !taken[name] {
+      syms[v] = name
+      taken[name] = true
+    }
+  }
+  return syms
+}
+
+func write(w io.Writer, f *formula, syms []string) error {
+  b := bufio.NewWriter(w)
+  if *getModel {
+    b.WriteString("(set-option :produce-models true)\n")
+  }
+  if *getCore {
+    b.WriteString("(set-option :produce-unsat-cores true)\n")
+  }
+  b.WriteString("(set-logic QF_UF)\n")
+  for v := 1; v <= f.vars; v++ {
+    fmt.Fprintf(b, "(declare-const %s Bool)\n", syms[v])
+  }
+  for i, c := range f.clauses {
+    lits := make([]string, len(c))
+    for j, l := range c {
+      lits[j] = syms[abs(l)]
+      if l < 0 {
+        lits[j] = "(not " + lits[j] + ")"
+      }
+    }
+    term := "false"
+    switch len(lits) {
+    case 0:
+    case 1:
+      term = lits[0]
+    default:
+      term = "(or " + strings.Join(lits, " ") + ")"
+    }
+    if *getCore {
+      fmt.Fprintf(b, "(assert (! %s :named c%d))\n", term, i+1)
+    } else {
+      fmt.Fprintf(b, "(assert %s)\n", term)
+    }
+  }
+  b.WriteString("(check-sat)\n")
+  if *getModel {
+    b.WriteString("(get-model)\n")
+  }
+  if *getCore {
+    b.WriteString("(get-unsat-core)\n")
+  }
+  return b.Flush()
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  f, err := parse(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  if err := write(os.Stdout, f, symbols(f, *useNames)); err != nil {
+    log.Fatalln(err)
+  }
+}
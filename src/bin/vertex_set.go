@@ -0,0 +1,278 @@
+/*
+A simple binary which encodes finding a clique, vertex cover or independent set of a graph in
+the DIMACS graph format as a CNF, and decodes a solver's model back into the vertices.
+Can be run by `vertex_set -f <GRAPH> -problem clique -k 5 > out.cnf`, and then with
+`-model <FILE>` on the solver's output to list the vertices it found.
+
+The graph is read as `p edge <vertices> <edges>` followed by an `e <u> <v>` line per edge, with
+vertices numbered from 1. Vertex v is variable v, so the first variables of a model are the
+chosen vertices. A clique of at least k vertices forbids choosing two non-adjacent vertices, an
+independent set of at least k vertices forbids choosing both ends of an edge, and a vertex cover
+of at most k vertices requires choosing one end of every edge. The bound is encoded with a
+sequential counter, whose auxiliary variables follow the vertices. Vertices are named
+`v<n>` by `c var` comments.
+
+The model is read from `v` lines in the competition format, or from a plain list of literals,
+and an `s UNSATISFIABLE` line reports that there is no such set.
+*/
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "strconv"
+  "strings"
+)
+
+var filePath = flag.String("f", "", "DIMACS graph to encode")
+var problem = flag.String("problem", "clique", "Set to find: clique|cover|independent")
+var k = flag.Int("k", 0, "Size of the set, the least for clique and independent, the most for cover")
+var modelPath = flag.String("model", "", "Decode this solver output into the vertices of the set instead of encoding")
+
+type graph struct {
+  vertices int
+  edges [][2]int
+}
+
+// maxLine is the longest line of a graph or a solver's output that is accepted.
+const maxLine = 64 * 1024 * 1024
+
+func parseGraph(r io.Reader) (*graph, error) {
+  g := &graph{vertices: -1}
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    parts := strings.Fields(scanner.Text())
+    if len(parts) == 0 || parts[0] == "c" {
+      continue
+    }
+    switch parts[0] {
+    case "p":
+      if len(parts) != 4 || (parts[1] != "edge" && parts[1] != "col") {
+        return nil, fmt.Errorf("line %d: expected header \"p edge <vertices> <edges>\"", line)
+      }
+      n, err := strconv.Atoi(parts[2])
+      if err != nil || n < 0 {
+        return nil, fmt.Errorf("line %d: invalid vertex count %s", line, parts[2])
+      }
+      g.vertices = n
+    case "e":
+      if g.vertices == -1 {
+        return nil, fmt.Errorf("line %d: edge before header", line)
+      }
+      if len(parts) != 3 {
+        return nil, fmt.Errorf("line %d: expected \"e <u> <v>\"", line)
+      }
+      var e [2]int
+      for i, part := range parts[1:] {
+        v, err := strconv.Atoi(part)
+        if err != nil || v < 1 || v > g.vertices {
+          return nil, fmt.Errorf("line %d: invalid vertex %s", line, part)
+        }
+        e[i] = v
+      }
+      g.edges = append(g.edges, e)
+    default:
+      return nil, fmt.Errorf("line %d: unknown line type %q", line, parts[0])
+    }
+  }
+  if g.vertices == -1 {
+    return nil, fmt.Errorf("missing header")
+  }
+  return g, scanner.Err()
+}
+
+// atMost returns the clauses of a sequential counter allowing at most k of lits to be true,
+// numbering its auxiliary variables from next. It returns the first unused variable.
+func atMost(lits []int, k, next int) ([][]int, int) {
+  n := len(lits)
+  if k >= n {
+    return nil, next
+  }
+  var clauses [][]int
+  if k == 0 {
+    for _, l := range lits {
+      clauses = append(clauses, []int{-l})
+    }
+    return clauses, next
+  }
+  // s(i, j) is true if at least j of the first i+1 literals are true.
+  s := func(i, j int) int { return next + i*k + j - 1 }
+  clauses = append(clauses, []int{-lits[0], s(0, 1)})
+  for j := 2; j <= k; j++ {
+    clauses = append(clauses, []int{-s(0, j)})
+  }
+  for i := 1; i < n-1; i++ {
+    clauses = append(clauses, []int{-lits[i], s(i, 1)}, []int{-s(i-1, 1), s(i, 1)})
+    for j := 2; j <= k; j++ {
+      clauses = append(clauses, []int{-lits[i], -s(i-1, j-1), s(i, j)}, []int{-s(i-1, j), s(i, j)})
+    }
+    clauses = append(clauses, []int{-lits[i], -s(i-1, k)})
+  }
+  clauses = append(clauses, []int{-lits[n-1], -s(n-2, k)})
+  return clauses, next + (n-1)*k
+}
+
+// encode returns the clauses requiring the chosen vertices to form the set, and the number of
+// variables used.
+func encode(g *graph, problem string, k int) ([][]int, int) {
+  var clauses [][]int
+  adjacent := make([]map[int]bool, g.vertices+1)
+  for v := range adjacent {
+    adjacent[v] = map[int]bool{}
+  }
+  for _, e := range g.edges {
+    adjacent[e[0]][e[1]] = true
+    adjacent[e[1]][e[0]] = true
+  }
+  switch problem {
+  case "clique":
+    for u := 1; u <= g.vertices; u++ {
+      for v := u + 1; v <= g.vertices; v++ {
+        if !adjacent[u][v] {
+          clauses = append(clauses, []int{-u, -v})
+        }
+      }
+    }
+  case "independent", "cover":
+    for u := 1; u <= g.vertices; u++ {
+      for v := u; v <= g.vertices; v++ {
+        if !adjacent[u][v] {
+          continue
+        }
+        if u == v {
+          // a loop must be in every cover and can't be in an independent set.
+          if problem == "cover" {
+            clauses = append(clauses, []int{u})
+          } else {
+            clauses = append(clauses, []int{-u})
+          }
+        } else if problem == "cover" {
+          clauses = append(clauses, []int{u, v})
+        } else {
+          clauses = append(clauses, []int{-u, -v})
+        }
+      }
+    }
+  }
+  // at least k chosen is at most vertices-k not chosen.
+  lits := make([]int, g.vertices)
+  for i := range lits {
+    lits[i] = -(i + 1)
+    if problem == "cover" {
+      lits[i] = i + 1
+    }
+  }
+  bound := g.vertices - k
+  if problem == "cover" {
+    bound = k
+  }
+  if bound < 0 {
+    return append(clauses, []int{}), g.vertices
+  }
+  counter, next := atMost(lits, bound, g.vertices+1)
+  return append(clauses, counter...), next - 1
+}
+
+func writeDimacs(w io.Writer, g *graph, clauses [][]int, vars int) error {
+  b := bufio.NewWriter(w)
+  for v := 1; v <= g.vertices; v++ {
+    fmt.Fprintf(b, "c var %d v%d\n", v, v)
+  }
+  fmt.Fprintf(b, "p cnf %d %d\n", vars, len(clauses))
+  for _, c := range clauses {
+    for _, l := range c {
+      fmt.Fprintf(b, "%d ", l)
+    }
+    b.WriteString("0\n")
+  }
+  return b.Flush()
+}
+
+// decode returns the vertices chosen by the model in r, and false if the solver reported no
+// model.
+func decode(r io.Reader, vertices int) ([]int, bool, error) {
+  var chosen []int
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64*1024), maxLine)
+  line := 0
+  for scanner.Scan() {
+    line++
+    parts := strings.Fields(scanner.Text())
+    if len(parts) == 0 || parts[0] == "c" {
+      continue
+    }
+    if parts[0] == "s" {
+      if len(parts) > 1 && parts[1] == "UNSATISFIABLE" {
+        return nil, false, nil
+      }
+      continue
+    }
+    if parts[0] == "v" {
+      parts = parts[1:]
+    }
+    for _, part := range parts {
+      l, err := strconv.Atoi(part)
+      if err != nil {
+        return nil, false, fmt.Errorf("line %d: invalid literal %s", line, part)
+      }
+      if l > 0 && l <= vertices {
+        chosen = append(chosen, l)
+      }
+    }
+  }
+  return chosen, true, scanner.Err()
+}
+
+func main() {
+  flag.Parse()
+  if *filePath == "" {
+    log.Fatalln("Must pass file")
+  }
+  if *problem != "clique" && *problem != "cover" && *problem != "independent" {
+    log.Fatalf("Unknown -problem %q, expected clique|cover|independent", *problem)
+  }
+  if *k < 0 {
+    log.Fatalln("-k must not be negative")
+  }
+  file, err := os.Open(*filePath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  g, err := parseGraph(file)
+  file.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *filePath, err)
+  }
+  if *modelPath == "" {
+    clauses, vars := encode(g, *problem, *k)
+    if err := writeDimacs(os.Stdout, g, clauses, vars); err != nil {
+      log.Fatalln(err)
+    }
+    return
+  }
+  model, err := os.Open(*modelPath)
+  if err != nil {
+    log.Fatalln(err)
+  }
+  chosen, ok, err := decode(model, g.vertices)
+  model.Close()
+  if err != nil {
+    log.Fatalf("%s: %v", *modelPath, err)
+  }
+  if !ok {
+    fmt.Printf("no %s of size %d\n", *problem, *k)
+    return
+  }
+  parts := make([]string, len(chosen))
+  for i, v := range chosen {
+    parts[i] = strconv.Itoa(v)
+  }
+  fmt.Printf("%s of %d vertices: %s\n", *problem, len(chosen), strings.Join(parts, " "))
+}
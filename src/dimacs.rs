@@ -1,6 +1,9 @@
 use crate::{clause::Clause, literal::Literal};
 use std::io;
 
+/// Reads the clauses of a dimacs file and its number of variables. A line starting with `%`
+/// ends the formula, as in the SATLIB benchmarks, whose trailing `0` would otherwise be read as
+/// an empty clause.
 pub fn from_dimacs<S>(s: S) -> io::Result<(Vec<Clause>, usize)>
 where
   S: AsRef<std::path::Path>, {
@@ -18,6 +21,9 @@ where
   for line in buf_reader.lines() {
     let line = line?;
     let line = line.trim();
+    if line.starts_with('%') {
+      break;
+    }
     if line.starts_with('c') {
       continue;
     }
@@ -58,3 +64,18 @@ where
   clauses.shrink_to_fit();
   Ok((clauses, max_var))
 }
+
+#[cfg(test)]
+mod test {
+  use super::*;
+  #[test]
+  fn stops_at_percent() {
+    let path = std::env::temp_dir().join("small_sat_stops_at_percent.cnf");
+    std::fs::write(&path, "p cnf 3 2\n1 -2 0\n2 3 0\n%\n0\n\n").unwrap();
+    let (clauses, max_var) = from_dimacs(&path).unwrap();
+    std::fs::remove_file(&path).unwrap();
+    assert_eq!(max_var, 3);
+    assert_eq!(clauses.len(), 2);
+    assert!(clauses.iter().all(|c| !c.is_empty()));
+  }
+}
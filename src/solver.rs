@@ -74,6 +74,9 @@ impl Solver {
   /// Attempt to find a satisfying assignment for the current solver
   pub fn solve(&mut self) -> Option<Vec<bool>> {
     assert_eq!(self.level, 0);
+    if let Some(sol) = self.db.get_solution() {
+      return sol;
+    }
     let mut unsolved_buffer = vec![];
     let mut to_write_buffer = vec![];
     let mut max_learnts = (self.db.initial().len() as f64) * LEARNTSIZE_FACTOR;
@@ -290,8 +293,14 @@ impl Solver {
   }
   pub fn from_dimacs<S: AsRef<std::path::Path>>(s: S) -> std::io::Result<Self> {
     use crate::dimacs::from_dimacs;
-    let (clauses, max_var) = from_dimacs(s)?;
+    let (mut clauses, max_var) = from_dimacs(s)?;
+    // An empty clause can't be watched, and makes the formula unsatisfiable outright.
+    let has_empty = clauses.iter().any(Clause::is_empty);
+    clauses.retain(|c| !c.is_empty());
     let db = ClauseDatabase::new(max_var, clauses);
+    if has_empty {
+      db.add_solution(None);
+    }
     let (wl, units) = WatchList::new(&db);
     let var_state = VariableState::from(&db);
     let mut solver = Self {
@@ -312,8 +321,10 @@ impl Solver {
       analyze_stack: RefCell::new(vec![]),
       analyze_seen: RefCell::new(HashMap::new()),
     };
-    for (cause, lit) in units {
-      assert_eq!(solver.with(lit, Some(cause.clone())), None, "UNSAT");
+    if !has_empty {
+      for (cause, lit) in units {
+        assert_eq!(solver.with(lit, Some(cause.clone())), None, "UNSAT");
+      }
     }
     Ok(solver)
   }
@@ -419,3 +430,24 @@ enum SeenState {
   Redundant,
   Required,
 }
+
+#[cfg(test)]
+mod test {
+  use super::*;
+  fn solve_str(name: &str, dimacs: &str) -> Option<Vec<bool>> {
+    let path = std::env::temp_dir().join(name);
+    std::fs::write(&path, dimacs).unwrap();
+    let mut solver = Solver::from_dimacs(&path).unwrap();
+    std::fs::remove_file(&path).unwrap();
+    solver.solve()
+  }
+  #[test]
+  fn empty_clause_is_unsat() {
+    assert_eq!(solve_str("small_sat_empty_clause.cnf", "p cnf 2 3\n1 2 0\n0\n-1 0\n"), None);
+  }
+  #[test]
+  fn percent_ends_formula() {
+    let sol = solve_str("small_sat_percent.cnf", "p cnf 2 2\n1 2 0\n-1 0\n%\n0\n\n");
+    assert_eq!(sol, Some(vec![false, true]));
+  }
+}